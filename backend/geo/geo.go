@@ -0,0 +1,75 @@
+// Package geo places items on the map: it turns addresses into coordinates
+// through a pluggable geocoder and measures distances between coordinates.
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+// EarthRadiusKm is the mean radius of the earth used for distances.
+const EarthRadiusKm = 6371.0
+
+// kmPerDegree is the length of one degree of latitude.
+const kmPerDegree = 111.32
+
+// CoarseDecimals is how many decimal places of a coordinate are shown before
+// a loan is approved. Two places locate a point to about a kilometre.
+const CoarseDecimals = 2
+
+var ErrInvalidPoint = errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+
+// Point is a position in decimal degrees.
+type Point struct {
+	Lat float64 `json:"latitude"`
+	Lng float64 `json:"longitude"`
+}
+
+// Valid reports whether p is a position on the earth.
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Coarse rounds p to CoarseDecimals decimal places.
+func (p Point) Coarse() Point {
+	scale := math.Pow(10, CoarseDecimals)
+	return Point{
+		Lat: math.Round(p.Lat*scale) / scale,
+		Lng: math.Round(p.Lng*scale) / scale,
+	}
+}
+
+// Distance returns the great-circle distance between a and b in km.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat, dLng := radians(b.Lat-a.Lat), radians(b.Lng-a.Lng)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Box is a latitude and longitude range.
+type Box struct {
+	MinLat, MaxLat float64
+	MinLng, MaxLng float64
+}
+
+// BoundingBox returns a box containing every point within radiusKm of
+// center. Near the poles or across the antimeridian it spans all longitudes.
+func BoundingBox(center Point, radiusKm float64) Box {
+	dLat := radiusKm / kmPerDegree
+	box := Box{MinLat: center.Lat - dLat, MaxLat: center.Lat + dLat, MinLng: -180, MaxLng: 180}
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat, box.MaxLat = math.Max(box.MinLat, -90), math.Min(box.MaxLat, 90)
+		return box
+	}
+
+	dLng := radiusKm / (kmPerDegree * math.Cos(radians(center.Lat)))
+	if center.Lng-dLng >= -180 && center.Lng+dLng <= 180 {
+		box.MinLng, box.MaxLng = center.Lng-dLng, center.Lng+dLng
+	}
+	return box
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
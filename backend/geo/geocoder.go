@@ -0,0 +1,49 @@
+package geo
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var ErrAddressNotFound = errors.New("address could not be located")
+
+// Geocoder is implemented by geocoding services.
+type Geocoder interface {
+	// Geocode returns the position of an address, or ErrAddressNotFound if
+	// the service does not know it.
+	Geocode(address string) (Point, error)
+}
+
+// StubGeocoder is an offline Geocoder for tests and local development. It
+// only knows the addresses added to it and never calls out to a service.
+type StubGeocoder struct {
+	mu     sync.Mutex
+	places map[string]Point
+}
+
+func NewStubGeocoder() *StubGeocoder {
+	return &StubGeocoder{places: make(map[string]Point)}
+}
+
+// Add makes the stub resolve address to p. Addresses are matched ignoring
+// case and surrounding whitespace.
+func (g *StubGeocoder) Add(address string, p Point) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.places[normalizeAddress(address)] = p
+}
+
+func (g *StubGeocoder) Geocode(address string) (Point, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.places[normalizeAddress(address)]
+	if !ok {
+		return Point{}, ErrAddressNotFound
+	}
+	return p, nil
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.Join(strings.Fields(address), " "))
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+type AutoApprovalRuleRequest struct {
+	ItemID              *uint `json:"itemId"`
+	MinCompletedReturns int   `json:"minCompletedReturns"`
+	RequireNoDisputes   bool  `json:"requireNoDisputes"`
+	MaxLoanDays         int   `json:"maxLoanDays"`
+	Enabled             *bool `json:"enabled"`
+}
+
+// applyAutoApprovalRuleRequest validates req and copies it onto rule. It
+// returns a message describing the first problem, or "" if req is valid.
+func applyAutoApprovalRuleRequest(db *gorm.DB, sellerID uint, req AutoApprovalRuleRequest, rule *models.AutoApprovalRule) string {
+	if req.MinCompletedReturns < 0 || req.MaxLoanDays < 0 {
+		return "Minimum completed returns and maximum loan days cannot be negative"
+	}
+	if req.ItemID != nil {
+		var item models.Item
+		if result := db.First(&item, *req.ItemID); result.Error != nil || item.SellerID != sellerID {
+			return "Rules can only target your own items"
+		}
+	}
+
+	rule.ItemID = req.ItemID
+	rule.MinCompletedReturns = req.MinCompletedReturns
+	rule.RequireNoDisputes = req.RequireNoDisputes
+	rule.MaxLoanDays = req.MaxLoanDays
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	return ""
+}
+
+// GetAutoApprovalRules lists the seller's auto-approval rules.
+func GetAutoApprovalRules(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var rules []models.AutoApprovalRule
+		if result := db.Where("seller_id = ?", userID).Order("id").Find(&rules); result.Error != nil {
+			http.Error(w, "Failed to fetch rules: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+func CreateAutoApprovalRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Check if the user is a seller
+		var user models.User
+		if result := db.First(&user, userID); result.Error != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if user.Role != models.RoleSeller {
+			http.Error(w, "Only sellers can create auto-approval rules", http.StatusForbidden)
+			return
+		}
+
+		// Parse the request body
+		var req AutoApprovalRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rule := models.AutoApprovalRule{SellerID: userID}
+		if msg := applyAutoApprovalRuleRequest(db, userID, req, &rule); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if result := db.Create(&rule); result.Error != nil {
+			log.Printf("Failed to create rule: %v", result.Error)
+			http.Error(w, "Failed to create rule: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Seller %d created auto-approval %s", userID, rule.Describe())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+func UpdateAutoApprovalRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the rule ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		var rule models.AutoApprovalRule
+		if result := db.First(&rule, id); result.Error != nil {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+
+		if rule.SellerID != userID {
+			http.Error(w, "You can only update your own rules", http.StatusForbidden)
+			return
+		}
+
+		// Parse the request body
+		var req AutoApprovalRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if msg := applyAutoApprovalRuleRequest(db, userID, req, &rule); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if result := db.Save(&rule); result.Error != nil {
+			http.Error(w, "Failed to update rule: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+func DeleteAutoApprovalRule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the rule ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		var rule models.AutoApprovalRule
+		if result := db.First(&rule, id); result.Error != nil {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+
+		if rule.SellerID != userID {
+			http.Error(w, "You can only delete your own rules", http.StatusForbidden)
+			return
+		}
+
+		if result := db.Delete(&rule); result.Error != nil {
+			http.Error(w, "Failed to delete rule: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetBorrowRequestAudit returns the audit log of a request to its buyer or
+// seller.
+func GetBorrowRequestAudit(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		if borrowRequest.BuyerID != userID && borrowRequest.Item.SellerID != userID {
+			http.Error(w, "You can only view the audit log of your own requests", http.StatusForbidden)
+			return
+		}
+
+		page, err := parsePageRequest(r, auditSortKeys, "createdAt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.AuditEntry{}).Where("borrow_request_id = ?", borrowRequest.ID).Session(&gorm.Session{})
+		total, err := page.countTotal(query)
+		if err != nil {
+			http.Error(w, "Failed to count audit log: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		paged, err := page.apply(query, "audit_entries.id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var entries []models.AuditEntry
+		if result := paged.Find(&entries); result.Error != nil {
+			http.Error(w, "Failed to fetch audit log: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := PageResponse{Items: entries, Total: total}
+		if page.hasMore(len(entries)) {
+			entries = entries[:page.limit]
+			last := entries[len(entries)-1]
+			response.Items = entries
+			response.NextCursor = page.nextCursor(last.CreatedAt, last.ID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
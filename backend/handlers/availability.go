@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+)
+
+// defaultAvailabilityWindow is used when the caller omits "to".
+const defaultAvailabilityWindow = 30 * 24 * time.Hour
+
+// RemainingInterval is a stretch of time during which the same number of
+// units is still free.
+type RemainingInterval struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Available int       `json:"available"`
+}
+
+type AvailabilityResponse struct {
+	ItemID uint      `json:"itemId"`
+	Frozen bool      `json:"frozen"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Capacity is the number of units that can be booked.
+	Capacity  int                 `json:"capacity"`
+	Booked    []models.Interval   `json:"booked"`
+	Remaining []RemainingInterval `json:"remaining"`
+	// Free lists the times when at least one unit is free.
+	Free []models.Interval `json:"free"`
+}
+
+func GetItemAvailability(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the item ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		// Find the item
+		var item models.Item
+		if result := db.First(&item, id); result.Error != nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+
+		// Parse the date range
+		from := time.Now().Truncate(24 * time.Hour)
+		if v := r.URL.Query().Get("from"); v != "" {
+			if from, err = parseDate(v); err != nil {
+				http.Error(w, "Invalid from date: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		to := from.Add(defaultAvailabilityWindow)
+		if v := r.URL.Query().Get("to"); v != "" {
+			if to, err = parseDate(v); err != nil {
+				http.Error(w, "Invalid to date: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if !from.Before(to) {
+			http.Error(w, "From date must be before to date", http.StatusBadRequest)
+			return
+		}
+
+		// Find the bookings in the range, including those of bundles that
+		// share units with this item
+		bookings, err := models.FindRelatedBookings(db, &item, from, to)
+		if err != nil {
+			log.Printf("Error fetching bookings: %v", err)
+			http.Error(w, "Failed to fetch availability: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		capacity, err := models.ItemCapacity(db, &item)
+		if err != nil {
+			http.Error(w, "Failed to fetch availability: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		booked := make([]models.Interval, 0, len(bookings))
+		for _, b := range bookings {
+			booked = append(booked, models.Interval{Start: b.StartDate, End: b.EndDate, RequestID: b.ID, Quantity: b.Quantity})
+		}
+
+		steps, err := models.RemainingUnits(db, &item, from, to)
+		if err != nil {
+			http.Error(w, "Failed to fetch availability: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// A frozen item has no free time until its dispute is resolved
+		frozen := item.Status == models.StatusFrozen
+		remaining := []RemainingInterval{}
+		var full []models.Interval
+		for _, step := range steps {
+			available := step.Quantity
+			if frozen {
+				available = 0
+			}
+			remaining = append(remaining, RemainingInterval{Start: step.Start, End: step.End, Available: available})
+			if available == 0 {
+				full = append(full, step)
+			}
+		}
+		free := []models.Interval{}
+		free = append(free, models.FreeIntervals(from, to, full)...)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AvailabilityResponse{
+			ItemID:    item.ID,
+			Frozen:    frozen,
+			From:      from,
+			To:        to,
+			Capacity:  capacity,
+			Booked:    booked,
+			Remaining: remaining,
+			Free:      free,
+		})
+	}
+}
+
+// parseDate accepts either a plain date (2006-01-02) or an RFC 3339 timestamp.
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,693 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+type RecurringBorrowRequestRequest struct {
+	ItemID uint `json:"itemId"`
+	// StartDate and EndDate are the dates of the first occurrence. Every
+	// occurrence lasts as long as the first.
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	// Recurrence is an RRULE such as "FREQ=WEEKLY;BYDAY=TU;COUNT=6".
+	Recurrence string `json:"recurrence"`
+	Message    string `json:"message"`
+}
+
+type BulkBorrowRequestRequest struct {
+	ItemIDs   []uint    `json:"itemIds"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	Message   string    `json:"message"`
+}
+
+// SkippedOccurrence is an occurrence of a recurring request that could not
+// be booked.
+type SkippedOccurrence struct {
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	Reason    string    `json:"reason"`
+}
+
+type RecurringBorrowRequestResponse struct {
+	Group   models.BorrowGroup  `json:"group"`
+	Skipped []SkippedOccurrence `json:"skipped"`
+}
+
+// checkBookable checks whether the buyer can book item from start to end. It
+// returns a message saying why not, or "" if the dates can be requested.
+func checkBookable(db *gorm.DB, item *models.Item, buyerID uint, start, end, now time.Time) (string, error) {
+	if item.Status == models.StatusFrozen {
+		return "Item is unavailable while a dispute is open", nil
+	}
+	if err := item.CheckLoanPolicy(start, end, now); err != nil {
+		return err.Error(), nil
+	}
+
+	err := models.CheckCapacity(db, item, start, end, 1, 0)
+	if errors.Is(err, models.ErrNotEnoughRoom) {
+		return "Item is already booked for the requested dates", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	offer, err := models.FindActiveWaitlistOffer(db, item.ID, now)
+	if err != nil {
+		return "", err
+	}
+	if offer != nil && offer.BlocksBooking(buyerID, start, end, now) {
+		return "Item is being held for a waitlisted borrower until " + offer.OfferExpiresAt.Format(time.RFC3339), nil
+	}
+	return "", nil
+}
+
+// loadBuyer returns the current user if they are a buyer. On failure it
+// writes the response and returns false.
+func loadBuyer(db *gorm.DB, w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var user models.User
+
+	// Get the user ID from the context
+	userID, ok := middleware.GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+		return user, false
+	}
+
+	if result := db.First(&user, userID); result.Error != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return user, false
+	}
+
+	if user.Role != models.RoleBuyer {
+		http.Error(w, "Only buyers can create borrow requests", http.StatusForbidden)
+		return user, false
+	}
+	return user, true
+}
+
+// groupQuantity returns the number of units asked for by a group of requests.
+func groupQuantity(requests []models.BorrowRequest) int {
+	n := 0
+	for _, br := range requests {
+		n += br.Quantity
+	}
+	return n
+}
+
+// checkGroupLimits applies the buyer's borrowing limits to the units of a
+// group of requests and returns the seller. On failure it writes the response
+// and returns false.
+func checkGroupLimits(db *gorm.DB, w http.ResponseWriter, buyerID, sellerID uint, requests []models.BorrowRequest) (models.User, bool) {
+	n := groupQuantity(requests)
+	var seller models.User
+	if result := db.First(&seller, sellerID); result.Error != nil {
+		http.Error(w, "Item owner not found", http.StatusInternalServerError)
+		return seller, false
+	}
+	if err := models.CheckBorrowingLimits(db, buyerID, &seller, n, MaxActiveLoansPerBuyer); err != nil {
+		log.Printf("User %d may not borrow %d items from seller %d: %v", buyerID, n, sellerID, err)
+		if !writeBorrowingLimitError(w, err) {
+			http.Error(w, "Failed to check borrowing limits: "+err.Error(), http.StatusInternalServerError)
+		}
+		return seller, false
+	}
+	return seller, true
+}
+
+// CreateRecurringBorrowRequest expands a recurrence into one borrow request
+// per occurrence. Occurrences that cannot be booked are skipped and reported
+// back; the rest are created and decided individually.
+func CreateRecurringBorrowRequest(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadBuyer(db, w, r)
+		if !ok {
+			return
+		}
+
+		// Parse the request body
+		var req RecurringBorrowRequestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.ItemID == 0 {
+			http.Error(w, "Item ID is required", http.StatusBadRequest)
+			return
+		}
+		if req.StartDate.IsZero() || req.EndDate.IsZero() || !req.StartDate.Before(req.EndDate) {
+			http.Error(w, "Start date must be before end date", http.StatusBadRequest)
+			return
+		}
+
+		recurrence, err := models.ParseRecurrence(req.Recurrence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		starts, err := recurrence.Occurrences(req.StartDate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(starts) == 0 {
+			http.Error(w, "Recurrence has no occurrences", http.StatusBadRequest)
+			return
+		}
+
+		// Occurrences are loans of the same item, so they cannot overlap
+		length := req.EndDate.Sub(req.StartDate)
+		for i := 1; i < len(starts); i++ {
+			if starts[i].Sub(starts[i-1]) < length {
+				http.Error(w, "Occurrences overlap, each loan must end before the next one starts", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Find the item
+		var item models.Item
+		if result := db.First(&item, req.ItemID); result.Error != nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+
+		// Check each occurrence separately
+		now := time.Now()
+		group := models.BorrowGroup{
+			Kind:       models.BorrowGroupRecurring,
+			BuyerID:    user.ID,
+			SellerID:   item.SellerID,
+			Recurrence: req.Recurrence,
+		}
+		skipped := []SkippedOccurrence{}
+		for _, start := range starts {
+			end := start.Add(length)
+			reason, err := checkBookable(db, &item, user.ID, start, end, now)
+			if err != nil {
+				http.Error(w, "Failed to check availability: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if reason != "" {
+				skipped = append(skipped, SkippedOccurrence{StartDate: start, EndDate: end, Reason: reason})
+				continue
+			}
+			group.Requests = append(group.Requests, models.BorrowRequest{
+				ItemID:    item.ID,
+				BuyerID:   user.ID,
+				Status:    models.StatusPending,
+				Quantity:  1,
+				StartDate: start,
+				EndDate:   end,
+				Message:   req.Message,
+			})
+		}
+
+		if len(group.Requests) == 0 {
+			http.Error(w, "None of the occurrences can be booked: "+skipped[0].Reason, http.StatusConflict)
+			return
+		}
+		seller, ok := checkGroupLimits(db, w, user.ID, item.SellerID, group.Requests)
+		if !ok {
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := recountBorrowingLimits(tx, user.ID, &seller, groupQuantity(group.Requests)); err != nil {
+				return err
+			}
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+			// Each occurrence is its own loan, so rules apply one by one
+			for i := range group.Requests {
+				rule, err := models.FindMatchingAutoApprovalRule(tx, item.SellerID, &group.Requests[i])
+				if err != nil {
+					return err
+				}
+				if rule == nil {
+					continue
+				}
+				err = autoApproveBorrowRequest(tx, &group.Requests[i], rule)
+				if isBookingConflict(err) {
+					log.Printf("Leaving occurrence %d for the seller: %v", group.Requests[i].ID, err)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			log.Printf("Failed to create recurring borrow request: %v", err)
+			if writeBorrowingLimitError(w, err) {
+				return
+			}
+			http.Error(w, "Failed to create recurring borrow request: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Recurring borrow request created: group %d with %d occurrences, %d skipped", group.ID, len(group.Requests), len(skipped))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(RecurringBorrowRequestResponse{Group: group, Skipped: skipped})
+	}
+}
+
+// CreateBulkBorrowRequest requests several items of one seller over the same
+// dates. Either every item can be booked and a request is created for each,
+// or nothing is created.
+func CreateBulkBorrowRequest(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadBuyer(db, w, r)
+		if !ok {
+			return
+		}
+
+		// Parse the request body
+		var req BulkBorrowRequestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(req.ItemIDs) < 2 {
+			http.Error(w, "A bulk request needs at least two items", http.StatusBadRequest)
+			return
+		}
+		if req.StartDate.IsZero() || req.EndDate.IsZero() || !req.StartDate.Before(req.EndDate) {
+			http.Error(w, "Start date must be before end date", http.StatusBadRequest)
+			return
+		}
+
+		var items []models.Item
+		if result := db.Where("id IN ?", req.ItemIDs).Find(&items); result.Error != nil {
+			http.Error(w, "Failed to fetch items: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(items) != len(req.ItemIDs) {
+			http.Error(w, "Items must exist and be listed only once", http.StatusBadRequest)
+			return
+		}
+
+		sellerID := items[0].SellerID
+		for _, item := range items {
+			if item.SellerID != sellerID {
+				http.Error(w, "All items in a bulk request must belong to the same seller", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// One unavailable item fails the whole request
+		now := time.Now()
+		group := models.BorrowGroup{
+			Kind:     models.BorrowGroupBulk,
+			BuyerID:  user.ID,
+			SellerID: sellerID,
+		}
+		for i := range items {
+			reason, err := checkBookable(db, &items[i], user.ID, req.StartDate, req.EndDate, now)
+			if err != nil {
+				http.Error(w, "Failed to check availability: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if reason != "" {
+				log.Printf("Bulk request by user %d failed on item %d: %s", user.ID, items[i].ID, reason)
+				http.Error(w, fmt.Sprintf("%s: %s", items[i].Title, reason), http.StatusConflict)
+				return
+			}
+			group.Requests = append(group.Requests, models.BorrowRequest{
+				ItemID:    items[i].ID,
+				BuyerID:   user.ID,
+				Status:    models.StatusPending,
+				Quantity:  1,
+				StartDate: req.StartDate,
+				EndDate:   req.EndDate,
+				Message:   req.Message,
+			})
+		}
+
+		seller, ok := checkGroupLimits(db, w, user.ID, sellerID, group.Requests)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := recountBorrowingLimits(tx, user.ID, &seller, groupQuantity(group.Requests)); err != nil {
+				return err
+			}
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+
+			// The group is only auto-approved if a rule covers every item
+			rules := make([]*models.AutoApprovalRule, len(group.Requests))
+			for i := range group.Requests {
+				rule, err := models.FindMatchingAutoApprovalRule(tx, sellerID, &group.Requests[i])
+				if err != nil || rule == nil {
+					return err
+				}
+				rules[i] = rule
+			}
+			// Approve all of them or, if one no longer fits, none
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				itemIDs := make([]uint, len(group.Requests))
+				for i := range group.Requests {
+					itemIDs[i] = group.Requests[i].ItemID
+				}
+				if err := lockGroupItems(tx, itemIDs); err != nil {
+					return err
+				}
+				for i := range group.Requests {
+					if err := autoApproveBorrowRequest(tx, &group.Requests[i], rules[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if isBookingConflict(err) {
+				log.Printf("Leaving bulk request %d for the seller: %v", group.ID, err)
+				return tx.Where("group_id = ?", group.ID).Order("id").Find(&group.Requests).Error
+			}
+			return err
+		})
+
+		if err != nil {
+			log.Printf("Failed to create bulk borrow request: %v", err)
+			if writeBorrowingLimitError(w, err) {
+				return
+			}
+			http.Error(w, "Failed to create bulk borrow request: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Bulk borrow request created: group %d with %d items", group.ID, len(group.Requests))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(group)
+	}
+}
+
+// loadBorrowGroup finds the group named in the URL with its requests and
+// their items. On failure it writes the response and returns false.
+func loadBorrowGroup(db *gorm.DB, w http.ResponseWriter, r *http.Request) (models.BorrowGroup, bool) {
+	var group models.BorrowGroup
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return group, false
+	}
+
+	result := db.Preload("Requests", func(db *gorm.DB) *gorm.DB { return db.Order("start_date, id") }).
+		Preload("Requests.Item").
+		First(&group, id)
+	if result.Error != nil {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return group, false
+	}
+	return group, true
+}
+
+// isBulkMember reports whether the request belongs to a bulk group and so
+// can only be decided together with the rest of its group.
+func isBulkMember(db *gorm.DB, borrowRequest *models.BorrowRequest) (bool, error) {
+	if borrowRequest.GroupID == nil {
+		return false, nil
+	}
+	var group models.BorrowGroup
+	if err := db.First(&group, *borrowRequest.GroupID).Error; err != nil {
+		return false, err
+	}
+	return group.Kind == models.BorrowGroupBulk, nil
+}
+
+// GetBorrowGroup returns a group and its requests to its buyer or seller.
+func GetBorrowGroup(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		group, ok := loadBorrowGroup(db, w, r)
+		if !ok {
+			return
+		}
+
+		if group.BuyerID != userID && group.SellerID != userID {
+			http.Error(w, "You can only view your own groups", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(group)
+	}
+}
+
+// ApproveBorrowGroup approves every pending request in a group at once. If
+// any of them cannot be approved, none are.
+func ApproveBorrowGroup(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		group, ok := loadBorrowGroup(db, w, r)
+		if !ok {
+			return
+		}
+
+		if group.SellerID != userID {
+			http.Error(w, "You can only approve requests for your own items", http.StatusForbidden)
+			return
+		}
+
+		var pending []*models.BorrowRequest
+		for i := range group.Requests {
+			br := &group.Requests[i]
+			if br.Status == models.StatusPending {
+				pending = append(pending, br)
+				continue
+			}
+			// A bulk group is only approved as a whole
+			if group.Kind == models.BorrowGroupBulk {
+				http.Error(w, fmt.Sprintf("%s: request is already %s", br.Item.Title, br.Status), http.StatusConflict)
+				return
+			}
+		}
+		if len(pending) == 0 {
+			http.Error(w, "Group has no pending requests", http.StatusConflict)
+			return
+		}
+
+		for _, br := range pending {
+			if err := br.TransitionTo(models.StatusApproved, models.ActorSeller); err != nil {
+				writeTransitionError(w, int(br.ID), err)
+				return
+			}
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			itemIDs := make([]uint, len(pending))
+			for i, br := range pending {
+				itemIDs[i] = br.ItemID
+			}
+			if err := lockGroupItems(tx, itemIDs); err != nil {
+				return err
+			}
+			for _, br := range pending {
+				detail := fmt.Sprintf("Approved by the seller with %s request %d", group.Kind, group.ID)
+				if br.NeedsOverride {
+					detail += ", overriding the item's maximum duration"
+				}
+				// Check inside the transaction so earlier approvals count
+				err := reserveForApproval(tx, br)
+				if errors.Is(err, models.ErrNotEnoughRoom) {
+					return fmt.Errorf("%w: %s is already booked from %s to %s", errGroupConflict, br.Item.Title,
+						br.StartDate.Format("2006-01-02"), br.EndDate.Format("2006-01-02"))
+				}
+				if isBookingConflict(err) {
+					return fmt.Errorf("%w: %s: %v", errGroupConflict, br.Item.Title, err)
+				}
+				if err != nil {
+					return err
+				}
+				if err := approveBorrowRequest(tx, br, models.AuditEntry{
+					Actor:   models.ActorSeller,
+					ActorID: &userID,
+					Detail:  detail,
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if errors.Is(err, errGroupConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to approve group %d: %v", group.ID, err)
+			http.Error(w, "Failed to approve group: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Seller %d approved %d requests of group %d", userID, len(pending), group.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(group)
+	}
+}
+
+// lockGroupItems locks the given items and every item related to them in one
+// ordered lock. Approving a group's requests one by one would lock each
+// item's set in turn, in an order that differs between groups, and let two
+// group approvals sharing items deadlock. It must run inside a transaction.
+func lockGroupItems(tx *gorm.DB, itemIDs []uint) error {
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, itemID := range itemIDs {
+		if seen[itemID] {
+			continue
+		}
+		seen[itemID] = true
+		var item models.Item
+		if err := tx.First(&item, itemID).Error; err != nil {
+			return err
+		}
+		related, err := models.RelatedItemIDs(tx, &item)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, related...)
+	}
+	return models.LockItems(tx, ids)
+}
+
+// errGroupConflict aborts a group approval when one of its requests overlaps
+// an existing booking.
+var errGroupConflict = errors.New("group cannot be approved")
+
+// errGroupDenyConflict aborts a group denial when one of its requests was
+// decided by someone else meanwhile.
+var errGroupDenyConflict = errors.New("group cannot be denied")
+
+// DenyBorrowGroup denies every pending request in a group with an optional
+// reason. The requests are denied together or not at all, and a bulk group
+// can only be denied while all of its requests are pending.
+func DenyBorrowGroup(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		group, ok := loadBorrowGroup(db, w, r)
+		if !ok {
+			return
+		}
+
+		if group.SellerID != userID {
+			http.Error(w, "You can only deny requests for your own items", http.StatusForbidden)
+			return
+		}
+
+		// The reason is optional, so an empty body is fine
+		var req DenyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var pending []*models.BorrowRequest
+		for i := range group.Requests {
+			br := &group.Requests[i]
+			if br.Status != models.StatusPending {
+				// A bulk group is only denied as a whole
+				if group.Kind == models.BorrowGroupBulk {
+					http.Error(w, fmt.Sprintf("%s: request is already %s", br.Item.Title, br.Status), http.StatusConflict)
+					return
+				}
+				continue
+			}
+			if err := br.TransitionTo(models.StatusDenied, models.ActorSeller); err != nil {
+				writeTransitionError(w, int(br.ID), err)
+				return
+			}
+			br.DenialReason = req.Reason
+			pending = append(pending, br)
+		}
+		if len(pending) == 0 {
+			http.Error(w, "Group has no pending requests", http.StatusConflict)
+			return
+		}
+
+		// Either every pending request is denied or none is
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, br := range pending {
+				result := tx.Model(&models.BorrowRequest{}).
+					Where("id = ? AND status = ?", br.ID, models.StatusPending).
+					Updates(map[string]interface{}{"status": br.Status, "denial_reason": br.DenialReason})
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return fmt.Errorf("%w: %s was decided meanwhile", errGroupDenyConflict, br.Item.Title)
+				}
+				if err := tx.Create(&models.AuditEntry{
+					BorrowRequestID: br.ID,
+					Action:          models.StatusDenied,
+					Actor:           models.ActorSeller,
+					ActorID:         &userID,
+					Detail:          req.Reason,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if errors.Is(err, errGroupDenyConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to deny group %d: %v", group.ID, err)
+			http.Error(w, "Failed to deny group: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Seller %d denied %d requests of group %d", userID, len(pending), group.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(group)
+	}
+}
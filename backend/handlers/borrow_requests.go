@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"encoding/json"
 	"net/http"
@@ -19,6 +22,18 @@ type BorrowRequestRequest struct {
     StartDate time.Time `json:"startDate"`
     EndDate   time.Time `json:"endDate"`
     Message   string    `json:"message"`
+    // RequestOverride asks the seller to approve a loan longer than the
+    // item's duration instead of rejecting it outright.
+    RequestOverride bool `json:"requestOverride"`
+    // Quantity is the number of units to reserve. It defaults to one.
+    Quantity int `json:"quantity"`
+    // JoinWaitlist queues the buyer for the item instead of failing when it
+    // is already booked or held for someone else.
+    JoinWaitlist bool `json:"joinWaitlist"`
+}
+
+type DenyRequest struct {
+	Reason string `json:"reason"`
 }
 
 func CreateBorrowRequest(db *gorm.DB) http.HandlerFunc {
@@ -80,6 +95,10 @@ func CreateBorrowRequest(db *gorm.DB) http.HandlerFunc {
             return
         }
 
+        if req.Quantity == 0 {
+            req.Quantity = 1
+        }
+
         // Find the item
         var item models.Item
         if result := db.First(&item, req.ItemID); result.Error != nil {
@@ -88,10 +107,87 @@ func CreateBorrowRequest(db *gorm.DB) http.HandlerFunc {
             return
         }
 
-        // Check if the item is available
-        if item.Status != models.StatusAvailable {
-            log.Printf("Item status is %s, not available", item.Status)
-            http.Error(w, "Item is not available for borrowing", http.StatusBadRequest)
+        // Items under dispute cannot be booked
+        if item.Status == models.StatusFrozen {
+            log.Printf("Item %d is frozen by an open dispute", item.ID)
+            http.Error(w, "Item is unavailable while a dispute is open", http.StatusConflict)
+            return
+        }
+
+        // Bundles are limited by their components when checking capacity
+        if req.Quantity < 1 || (!item.IsBundle() && req.Quantity > item.Quantity) {
+            log.Printf("Invalid quantity %d for item %d", req.Quantity, item.ID)
+            http.Error(w, fmt.Sprintf("Quantity must be between 1 and %d", item.Quantity), http.StatusBadRequest)
+            return
+        }
+
+        // Check the buyer is allowed to borrow from this seller
+        var seller models.User
+        if result := db.First(&seller, item.SellerID); result.Error != nil {
+            log.Printf("Seller %d of item %d not found: %v", item.SellerID, item.ID, result.Error)
+            http.Error(w, "Item owner not found", http.StatusInternalServerError)
+            return
+        }
+        if err := models.CheckBorrowingLimits(db, userID, &seller, req.Quantity, MaxActiveLoansPerBuyer); err != nil {
+            log.Printf("User %d may not borrow item %d: %v", userID, item.ID, err)
+            if !writeBorrowingLimitError(w, err) {
+                http.Error(w, "Failed to check borrowing limits: "+err.Error(), http.StatusInternalServerError)
+            }
+            return
+        }
+
+        // Check the request against the item's loan policy
+        needsOverride := false
+        if err := item.CheckLoanPolicy(req.StartDate, req.EndDate, time.Now()); err != nil {
+            if !errors.Is(err, models.ErrLoanTooLong) || !req.RequestOverride {
+                log.Printf("Request violates loan policy of item %d: %v", item.ID, err)
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            log.Printf("Routing request to seller for override: %v", err)
+            needsOverride = true
+        }
+
+        // Check that enough units are left free for these dates
+        err := models.CheckCapacity(db, &item, req.StartDate, req.EndDate, req.Quantity, 0)
+        booked := errors.Is(err, models.ErrNotEnoughRoom)
+        if err != nil && !booked {
+            log.Printf("Failed to check for conflicting requests: %v", err)
+            http.Error(w, "Failed to check availability: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        // A waitlist offer holds the item for the offered buyer only
+        now := time.Now()
+        offer, err := models.FindActiveWaitlistOffer(db, item.ID, now)
+        if err != nil {
+            log.Printf("Failed to check waitlist offers: %v", err)
+            http.Error(w, "Failed to check availability: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+        heldForOther := offer != nil && offer.BlocksBooking(userID, req.StartDate, req.EndDate, now)
+
+        if booked || heldForOther {
+            if req.JoinWaitlist {
+                entry, err := joinWaitlist(db, item.ID, userID)
+                if err != nil {
+                    log.Printf("Failed to join waitlist: %v", err)
+                    http.Error(w, "Failed to join waitlist: "+err.Error(), http.StatusInternalServerError)
+                    return
+                }
+                log.Printf("Item %d is unavailable, added user %d to its waitlist", item.ID, userID)
+                w.Header().Set("Content-Type", "application/json")
+                w.WriteHeader(http.StatusAccepted)
+                json.NewEncoder(w).Encode(entry)
+                return
+            }
+            if heldForOther {
+                log.Printf("Item %d is held for waitlist entry %d", item.ID, offer.ID)
+                http.Error(w, "Item is being held for a waitlisted borrower until "+offer.OfferExpiresAt.Format(time.RFC3339), http.StatusConflict)
+                return
+            }
+            log.Printf("Item %d is already booked between %s and %s", item.ID, req.StartDate, req.EndDate)
+            http.Error(w, "Item is already booked for the requested dates", http.StatusConflict)
             return
         }
 
@@ -99,15 +195,53 @@ func CreateBorrowRequest(db *gorm.DB) http.HandlerFunc {
         borrowRequest := models.BorrowRequest{
             ItemID:    req.ItemID,
             BuyerID:   userID,
+            Quantity:  req.Quantity,
             Status:    models.StatusPending,
             StartDate: req.StartDate,
             EndDate:   req.EndDate,
             Message:   req.Message,
+            NeedsOverride: needsOverride,
         }
 
-        if result := db.Create(&borrowRequest); result.Error != nil {
-            log.Printf("Failed to create borrow request: %v", result.Error)
-            http.Error(w, "Failed to create borrow request: "+result.Error.Error(), http.StatusInternalServerError)
+        // Create the request under the buyer's waitlist offer if they hold
+        // one; approving it claims the offer
+        err = db.Transaction(func(tx *gorm.DB) error {
+            if err := recountBorrowingLimits(tx, userID, &seller, req.Quantity); err != nil {
+                return err
+            }
+            if err := tx.Create(&borrowRequest).Error; err != nil {
+                return err
+            }
+            if offer != nil && offer.BuyerID == userID {
+                offer.ClaimedRequestID = &borrowRequest.ID
+                if err := tx.Save(offer).Error; err != nil {
+                    return err
+                }
+            }
+
+            // Requests that need a policy override always go to the seller
+            if needsOverride {
+                return nil
+            }
+            rule, err := models.FindMatchingAutoApprovalRule(tx, item.SellerID, &borrowRequest)
+            if err != nil || rule == nil {
+                return err
+            }
+            err = autoApproveBorrowRequest(tx, &borrowRequest, rule)
+            if isBookingConflict(err) {
+                // The request no longer fits, so the seller decides
+                log.Printf("Leaving request %d for the seller: %v", borrowRequest.ID, err)
+                return nil
+            }
+            return err
+        })
+
+        if err != nil {
+            log.Printf("Failed to create borrow request: %v", err)
+            if writeBorrowingLimitError(w, err) {
+                return
+            }
+            http.Error(w, "Failed to create borrow request: "+err.Error(), http.StatusInternalServerError)
             return
         }
 
@@ -119,6 +253,139 @@ func CreateBorrowRequest(db *gorm.DB) http.HandlerFunc {
     }
 }
 
+// recountBorrowingLimits checks the buyer's borrowing limits again inside the
+// transaction creating their requests. The buyer is locked first so that
+// concurrent requests cannot together exceed a limit.
+func recountBorrowingLimits(tx *gorm.DB, buyerID uint, seller *models.User, requested int) error {
+	if err := models.LockBuyer(tx, buyerID); err != nil {
+		return err
+	}
+	return models.CheckBorrowingLimits(tx, buyerID, seller, requested, MaxActiveLoansPerBuyer)
+}
+
+// errItemFrozen refuses approvals of items frozen by an open dispute.
+var errItemFrozen = errors.New("item is unavailable while a dispute is open")
+
+// isBookingConflict reports whether err from reserveForApproval means the
+// request can no longer be approved, rather than a database failure.
+func isBookingConflict(err error) bool {
+	return errors.Is(err, models.ErrNotEnoughRoom) || errors.Is(err, errItemFrozen) ||
+		errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrLoanTooLong)
+}
+
+// reserveForApproval locks the request's item and every item sharing units
+// with it, then checks that the request is still pending, still within the
+// item's maximum loan length unless it asked for an override, and fits in the
+// units left free. Holding the locks until the transaction commits keeps two
+// overlapping approvals from both passing the check. It must run inside a
+// transaction, before approveBorrowRequest.
+func reserveForApproval(tx *gorm.DB, borrowRequest *models.BorrowRequest) error {
+	var item models.Item
+	if err := tx.First(&item, borrowRequest.ItemID).Error; err != nil {
+		return err
+	}
+	if err := models.LockRelatedItems(tx, &item); err != nil {
+		return err
+	}
+	// Reload the item now that it is locked, in case it was frozen or
+	// changed meanwhile
+	if err := tx.First(&item, item.ID).Error; err != nil {
+		return err
+	}
+
+	// Another approval or the buyer may have changed it meanwhile
+	if err := models.LockTransition(tx, borrowRequest.ID, models.StatusApproved, models.ActorSystem); err != nil {
+		return err
+	}
+
+	if item.Status == models.StatusFrozen {
+		return errItemFrozen
+	}
+	// The seller may have shortened the loan length since the request
+	if !borrowRequest.NeedsOverride {
+		if err := item.CheckLoanLength(borrowRequest.StartDate, borrowRequest.EndDate); err != nil {
+			return err
+		}
+	}
+	return models.CheckCapacity(tx, &item, borrowRequest.StartDate, borrowRequest.EndDate, borrowRequest.Quantity, borrowRequest.ID)
+}
+
+// errStatusChanged aborts a status change when the request's stored status
+// changed after it was loaded.
+var errStatusChanged = errors.New("borrow request was changed meanwhile")
+
+// saveTransition saves the new status of a request that was moved from
+// status from, along with values, but only if its stored status is still
+// from. Otherwise it returns errStatusChanged, so that a concurrent change
+// is not overwritten.
+func saveTransition(tx *gorm.DB, borrowRequest *models.BorrowRequest, from models.Status, values map[string]interface{}) error {
+	values["status"] = borrowRequest.Status
+	result := tx.Model(&models.BorrowRequest{}).
+		Where("id = ? AND status = ?", borrowRequest.ID, from).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errStatusChanged
+	}
+	return nil
+}
+
+// approveBorrowRequest saves a request that has just been moved to approved.
+// It issues the pickup code, denies pending requests that overlap the approved
+// dates and records audit in the request's audit log. It must run inside a
+// transaction, after reserveForApproval.
+func approveBorrowRequest(tx *gorm.DB, borrowRequest *models.BorrowRequest, audit models.AuditEntry) error {
+	// The item stays available until the buyer picks it up with this code
+	pickupCode, err := models.GenerateHandoffCode()
+	if err != nil {
+		return fmt.Errorf("generating pickup code: %w", err)
+	}
+	now := time.Now()
+	borrowRequest.PickupCode = pickupCode
+	borrowRequest.ApprovedAt = &now
+
+	if err := tx.Omit("Item").Save(borrowRequest).Error; err != nil {
+		return err
+	}
+	if err := models.ClaimWaitlistOffer(tx, borrowRequest); err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("Automatically denied: the item was booked by another borrower from %s to %s",
+		borrowRequest.StartDate.Format("2006-01-02"), borrowRequest.EndDate.Format("2006-01-02"))
+	denied, err := models.DenyOverlappingPending(tx, borrowRequest, reason)
+	if err != nil {
+		return err
+	}
+	if denied > 0 {
+		log.Printf("Auto-denied %d overlapping pending requests for item %d", denied, borrowRequest.ItemID)
+	}
+
+	audit.BorrowRequestID = borrowRequest.ID
+	audit.Action = models.StatusApproved
+	return tx.Create(&audit).Error
+}
+
+// autoApproveBorrowRequest approves a pending request on behalf of the
+// seller's auto-approval rule. It returns the error of reserveForApproval if
+// the request cannot be approved. It must run inside a transaction.
+func autoApproveBorrowRequest(tx *gorm.DB, borrowRequest *models.BorrowRequest, rule *models.AutoApprovalRule) error {
+	if err := reserveForApproval(tx, borrowRequest); err != nil {
+		return err
+	}
+	if err := borrowRequest.TransitionTo(models.StatusApproved, models.ActorSystem); err != nil {
+		return err
+	}
+	log.Printf("Auto-approving borrow request %d by %s", borrowRequest.ID, rule.Describe())
+	return approveBorrowRequest(tx, borrowRequest, models.AuditEntry{
+		Actor:  models.ActorSystem,
+		RuleID: &rule.ID,
+		Detail: "Automatically approved by " + rule.Describe(),
+	})
+}
+
 func ApproveBorrowRequest(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the user ID from the context
@@ -155,30 +422,61 @@ func ApproveBorrowRequest(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		// Check if the request is pending
-		if borrowRequest.Status != models.StatusPending {
-			log.Printf("Request %d is not pending (status: %s)", id, borrowRequest.Status)
-			http.Error(w, "Only pending requests can be approved", http.StatusBadRequest)
+		// Bulk requests are decided as a group
+		bulk, err := isBulkMember(db, &borrowRequest)
+		if err != nil {
+			http.Error(w, "Failed to load request group: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if bulk {
+			http.Error(w, "This request is part of a bulk request, approve the whole group instead", http.StatusConflict)
 			return
 		}
 
-		// Update the borrow request status
-		borrowRequest.Status = models.StatusApproved
+		// Move the request to approved
+		if err := borrowRequest.TransitionTo(models.StatusApproved, models.ActorSeller); err != nil {
+			writeTransitionError(w, id, err)
+			return
+		}
 
-		// Update the item status
-		borrowRequest.Item.Status = models.StatusBorrowed
+		detail := "Approved by the seller"
+		if borrowRequest.NeedsOverride {
+			log.Printf("Seller %d is overriding the loan policy for request %d", userID, id)
+			detail = "Approved by the seller, overriding the item's maximum duration"
+		}
 
-		// Save the changes in a transaction
+		// Check that approved requests leave enough units for this one while
+		// holding the item, so a concurrent approval cannot take them
 		err = db.Transaction(func(tx *gorm.DB) error {
-			if err := tx.Save(&borrowRequest).Error; err != nil {
+			if err := reserveForApproval(tx, &borrowRequest); err != nil {
 				return err
 			}
-			if err := tx.Save(&borrowRequest.Item).Error; err != nil {
-				return err
-			}
-			return nil
+			return approveBorrowRequest(tx, &borrowRequest, models.AuditEntry{
+				Actor:   models.ActorSeller,
+				ActorID: &userID,
+				Detail:  detail,
+			})
 		})
 
+		if errors.Is(err, models.ErrNotEnoughRoom) {
+			log.Printf("Request %d does not fit in the free units of item %d", id, borrowRequest.ItemID)
+			http.Error(w, "Item is already booked for the requested dates", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, errItemFrozen) {
+			log.Printf("Item %d is frozen by an open dispute", borrowRequest.ItemID)
+			http.Error(w, "Item is unavailable while a dispute is open", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, models.ErrLoanTooLong) {
+			log.Printf("Request %d no longer fits the loan policy of item %d: %v", id, borrowRequest.ItemID, err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidTransition) {
+			writeTransitionError(w, id, err)
+			return
+		}
 		if err != nil {
 			log.Printf("Failed to approve borrow request: %v", err)
 			http.Error(w, "Failed to approve borrow request: "+err.Error(), http.StatusInternalServerError)
@@ -229,20 +527,57 @@ func DenyBorrowRequest(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		// Check if the request is pending
-		if borrowRequest.Status != models.StatusPending {
-			log.Printf("Request %d is not pending (status: %s)", id, borrowRequest.Status)
-			http.Error(w, "Only pending requests can be denied", http.StatusBadRequest)
+		// Bulk requests are decided as a group
+		bulk, err := isBulkMember(db, &borrowRequest)
+		if err != nil {
+			http.Error(w, "Failed to load request group: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if bulk {
+			http.Error(w, "This request is part of a bulk request, deny the whole group instead", http.StatusConflict)
+			return
+		}
+
+		// Move the request to denied
+		if err := borrowRequest.TransitionTo(models.StatusDenied, models.ActorSeller); err != nil {
+			writeTransitionError(w, id, err)
+			return
+		}
+
+		// The reason is optional, so an empty body is fine
+		var req DenyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			log.Printf("Failed to decode request body: %v", err)
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Update the borrow request status
-		borrowRequest.Status = models.StatusDenied
+		borrowRequest.DenialReason = req.Reason
 
-		// Save the changes
-		if result := db.Save(&borrowRequest); result.Error != nil {
-			log.Printf("Failed to deny borrow request: %v", result.Error)
-			http.Error(w, "Failed to deny borrow request: "+result.Error.Error(), http.StatusInternalServerError)
+		// Save the changes along with an audit entry, unless the request was
+		// approved, cancelled or expired meanwhile
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := saveTransition(tx, &borrowRequest, models.StatusPending, map[string]interface{}{
+				"denial_reason": borrowRequest.DenialReason,
+			}); err != nil {
+				return err
+			}
+			return tx.Create(&models.AuditEntry{
+				BorrowRequestID: borrowRequest.ID,
+				Action:          models.StatusDenied,
+				Actor:           models.ActorSeller,
+				ActorID:         &userID,
+				Detail:          req.Reason,
+			}).Error
+		})
+
+		if errors.Is(err, errStatusChanged) {
+			writeTransitionError(w, id, err)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to deny borrow request: %v", err)
+			http.Error(w, "Failed to deny borrow request: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 		
@@ -263,16 +598,42 @@ func GetMyBorrowRequests(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		// Find all borrow requests for the user
+		page, err := parsePageRequest(r, borrowRequestSortKeys, "-createdAt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.BorrowRequest{}).Where("buyer_id = ?", userID).Session(&gorm.Session{})
+		total, err := page.countTotal(query)
+		if err != nil {
+			http.Error(w, "Failed to count borrow requests: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Find a page of borrow requests for the user
+		paged, err := page.apply(query, "borrow_requests.id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		var borrowRequests []models.BorrowRequest
-		if result := db.Where("buyer_id = ?", userID).Preload("Item").Preload("Item.Seller").Find(&borrowRequests); result.Error != nil {
+		if result := paged.Preload("Item").Preload("Item.Seller").Preload("Extensions").Preload("ConditionReports.Photos").Preload("Units").Find(&borrowRequests); result.Error != nil {
 			http.Error(w, "Failed to fetch borrow requests: "+result.Error.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// Return the borrow requests
+		response := PageResponse{Items: borrowRequests, Total: total}
+		if page.hasMore(len(borrowRequests)) {
+			borrowRequests = borrowRequests[:page.limit]
+			last := borrowRequests[len(borrowRequests)-1]
+			response.Items = borrowRequests
+			response.NextCursor = page.nextCursor(borrowRequestSortValue(page, &last), last.ID)
+		}
+
+		// Return the page of borrow requests
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(borrowRequests)
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
@@ -288,12 +649,36 @@ func GetRequestsForMyItems(db *gorm.DB) http.HandlerFunc {
 		
 		log.Printf("Fetching borrow requests for user ID: %d", userID)
 
-		// Find all borrow requests for the user's items
-		var borrowRequests []models.BorrowRequest
-		if result := db.Joins("JOIN items ON borrow_requests.item_id = items.id").
+		page, err := parsePageRequest(r, borrowRequestSortKeys, "-createdAt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.BorrowRequest{}).
+			Joins("JOIN items ON borrow_requests.item_id = items.id").
 			Where("items.seller_id = ?", userID).
+			Session(&gorm.Session{})
+		total, err := page.countTotal(query)
+		if err != nil {
+			log.Printf("Failed to count borrow requests: %v", err)
+			http.Error(w, "Failed to count borrow requests: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Find a page of borrow requests for the user's items
+		paged, err := page.apply(query, "borrow_requests.id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var borrowRequests []models.BorrowRequest
+		if result := paged.
 			Preload("Item").
 			Preload("Buyer").
+			Preload("Extensions").
+			Preload("ConditionReports.Photos").
+			Preload("Units").
 			Find(&borrowRequests); result.Error != nil {
 			log.Printf("Failed to fetch borrow requests: %v", result.Error)
 			http.Error(w, "Failed to fetch borrow requests: "+result.Error.Error(), http.StatusInternalServerError)
@@ -312,11 +697,19 @@ func GetRequestsForMyItems(db *gorm.DB) http.HandlerFunc {
 			}
 		}
 
+		response := PageResponse{Items: borrowRequests, Total: total}
+		if page.hasMore(len(borrowRequests)) {
+			borrowRequests = borrowRequests[:page.limit]
+			last := borrowRequests[len(borrowRequests)-1]
+			response.Items = borrowRequests
+			response.NextCursor = page.nextCursor(borrowRequestSortValue(page, &last), last.ID)
+		}
+
 		// Set the content type header
 		w.Header().Set("Content-Type", "application/json")
 		
 		// Encode the response
-		if err := json.NewEncoder(w).Encode(borrowRequests); err != nil {
+		if err := json.NewEncoder(w).Encode(response); err != nil {
 			log.Printf("Error encoding response: %v", err)
 			http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
 			return
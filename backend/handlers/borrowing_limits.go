@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+// MaxActiveLoansPerBuyer caps how many units a buyer may hold across all
+// sellers. Zero means no limit. main overrides it from the environment.
+var MaxActiveLoansPerBuyer = 0
+
+type LendingSettingsRequest struct {
+	MaxLoansPerBuyer int `json:"maxLoansPerBuyer"`
+}
+
+type BlockBuyerRequest struct {
+	BuyerID uint   `json:"buyerId"`
+	Reason  string `json:"reason"`
+}
+
+// loadSeller returns the current user if they are a seller. On failure it
+// writes the response and returns false.
+func loadSeller(db *gorm.DB, w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var user models.User
+
+	// Get the user ID from the context
+	userID, ok := middleware.GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+		return user, false
+	}
+
+	if result := db.First(&user, userID); result.Error != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return user, false
+	}
+
+	if user.Role != models.RoleSeller {
+		http.Error(w, "Only sellers can manage lending settings", http.StatusForbidden)
+		return user, false
+	}
+	return user, true
+}
+
+// UpdateLendingSettings sets the seller's per-buyer loan limit.
+func UpdateLendingSettings(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadSeller(db, w, r)
+		if !ok {
+			return
+		}
+
+		// Parse the request body
+		var req LendingSettingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.MaxLoansPerBuyer < 0 {
+			http.Error(w, "Maximum loans per buyer cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		user.MaxLoansPerBuyer = req.MaxLoansPerBuyer
+		if result := db.Model(&user).Update("max_loans_per_buyer", user.MaxLoansPerBuyer); result.Error != nil {
+			http.Error(w, "Failed to update lending settings: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// GetBlockedBuyers lists the buyers the seller has blocked.
+func GetBlockedBuyers(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadSeller(db, w, r)
+		if !ok {
+			return
+		}
+
+		var blocked []models.BlockedBuyer
+		if result := db.Preload("Buyer").Where("seller_id = ?", user.ID).Order("created_at DESC").Find(&blocked); result.Error != nil {
+			http.Error(w, "Failed to fetch blocked buyers: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocked)
+	}
+}
+
+// BlockBuyer stops a buyer from requesting the seller's items. Requests the
+// buyer already made are left alone.
+func BlockBuyer(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadSeller(db, w, r)
+		if !ok {
+			return
+		}
+
+		// Parse the request body
+		var req BlockBuyerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.BuyerID == 0 || req.BuyerID == user.ID {
+			http.Error(w, "A valid buyer ID is required", http.StatusBadRequest)
+			return
+		}
+
+		var buyer models.User
+		if result := db.First(&buyer, req.BuyerID); result.Error != nil {
+			http.Error(w, "Buyer not found", http.StatusNotFound)
+			return
+		}
+
+		blocked, err := models.IsBuyerBlocked(db, user.ID, buyer.ID)
+		if err != nil {
+			http.Error(w, "Failed to check blocklist: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "Buyer is already blocked", http.StatusConflict)
+			return
+		}
+
+		entry := models.BlockedBuyer{
+			SellerID: user.ID,
+			BuyerID:  buyer.ID,
+			Buyer:    buyer,
+			Reason:   req.Reason,
+		}
+		if result := db.Omit("Buyer").Create(&entry); result.Error != nil {
+			http.Error(w, "Failed to block buyer: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Seller %d blocked buyer %d", user.ID, buyer.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+// UnblockBuyer removes a buyer from the seller's blocklist.
+func UnblockBuyer(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadSeller(db, w, r)
+		if !ok {
+			return
+		}
+
+		// Get the buyer ID from the URL
+		vars := mux.Vars(r)
+		buyerID, err := strconv.Atoi(vars["buyerId"])
+		if err != nil {
+			http.Error(w, "Invalid buyer ID", http.StatusBadRequest)
+			return
+		}
+
+		result := db.Where("seller_id = ? AND buyer_id = ?", user.ID, buyerID).Delete(&models.BlockedBuyer{})
+		if result.Error != nil {
+			http.Error(w, "Failed to unblock buyer: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			http.Error(w, "Buyer is not blocked", http.StatusNotFound)
+			return
+		}
+
+		log.Printf("Seller %d unblocked buyer %d", user.ID, buyerID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+// CancelBorrowRequest lets the buyer withdraw a pending request, or cancel an
+// approved one inside the item's cancellation window.
+func CancelBorrowRequest(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			log.Printf("Invalid borrow request ID: %v", err)
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Cancelling borrow request ID: %d for user ID: %d", id, userID)
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			log.Printf("Borrow request not found: %v", result.Error)
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the user is the buyer
+		if borrowRequest.BuyerID != userID {
+			log.Printf("User %d is not the buyer of request %d", userID, id)
+			http.Error(w, "You can only cancel your own borrow requests", http.StatusForbidden)
+			return
+		}
+
+		now := time.Now()
+		previous := borrowRequest.Status
+		wasApproved := previous == models.StatusApproved
+
+		// Approved loans can only be cancelled inside the item's window
+		if wasApproved {
+			if err := borrowRequest.Item.CheckCancellation(borrowRequest.StartDate, now); err != nil {
+				log.Printf("Request %d cannot be cancelled: %v", id, err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Move the request to cancelled
+		if err := borrowRequest.TransitionTo(models.StatusCancelled, models.ActorBuyer); err != nil {
+			writeTransitionError(w, id, err)
+			return
+		}
+		borrowRequest.CancelledAt = &now
+
+		// Save the changes in a transaction, releasing the booked dates to the
+		// waitlist if the loan had already been approved. The item itself is
+		// only marked borrowed at pickup, so its status is unchanged. A request
+		// decided or picked up meanwhile is left alone.
+		borrowRequest.PickupCode = ""
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := saveTransition(tx, &borrowRequest, previous, map[string]interface{}{
+				"cancelled_at": borrowRequest.CancelledAt,
+				"pickup_code":  borrowRequest.PickupCode,
+			}); err != nil {
+				return err
+			}
+			if wasApproved {
+				if _, err := models.OfferNextWaitlistEntry(tx, borrowRequest.ItemID, now, WaitlistClaimWindow); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if errors.Is(err, errStatusChanged) {
+			writeTransitionError(w, id, err)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to cancel borrow request: %v", err)
+			http.Error(w, "Failed to cancel borrow request: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Successfully cancelled borrow request %d", id)
+
+		// Return the updated borrow request
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(borrowRequest)
+	}
+}
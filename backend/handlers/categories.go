@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+type CategoryRequest struct {
+	Name string `json:"name"`
+	// Slug defaults to one derived from the name.
+	Slug     string `json:"slug"`
+	ParentID *uint  `json:"parentId"`
+}
+
+// applyCategoryRequest validates req and copies it onto category. It
+// returns a message describing the first problem, or "" if req is valid.
+func applyCategoryRequest(db *gorm.DB, req CategoryRequest, category *models.Category) string {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "Name is required"
+	}
+	slug := models.Slugify(req.Slug)
+	if slug == "" {
+		slug = models.Slugify(name)
+	}
+	if slug == "" {
+		return "Name or slug must contain letters or digits"
+	}
+
+	var clash int64
+	if err := db.Model(&models.Category{}).Where("slug = ? AND id <> ?", slug, category.ID).Count(&clash).Error; err != nil || clash > 0 {
+		return "A category with this slug already exists"
+	}
+
+	if req.ParentID != nil {
+		if _, err := models.FindCategory(db, *req.ParentID, ""); err != nil {
+			return "Parent category not found"
+		}
+		if category.ID != 0 {
+			if err := models.CheckCategoryParent(db, category.ID, *req.ParentID); err != nil {
+				return err.Error()
+			}
+		}
+	}
+
+	category.Name = name
+	category.Slug = slug
+	category.ParentID = req.ParentID
+	return ""
+}
+
+// loadAdminCategory checks that the user is an admin and loads the category
+// named in the URL. It writes the error response itself and returns nil on
+// failure.
+func loadAdminCategory(db *gorm.DB, w http.ResponseWriter, r *http.Request) *models.Category {
+	userID, ok := middleware.GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+		return nil
+	}
+	if !isAdmin(db, userID) {
+		http.Error(w, "Only admins can manage categories", http.StatusForbidden)
+		return nil
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return nil
+	}
+
+	var category models.Category
+	if result := db.First(&category, id); result.Error != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return nil
+	}
+	return &category
+}
+
+// GetCategories returns the category tree.
+func GetCategories(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tree, err := models.CategoryTree(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch categories: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tree)
+	}
+}
+
+func CreateCategory(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if !isAdmin(db, userID) {
+			http.Error(w, "Only admins can manage categories", http.StatusForbidden)
+			return
+		}
+
+		// Parse the request body
+		var req CategoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var category models.Category
+		if msg := applyCategoryRequest(db, req, &category); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if result := db.Create(&category); result.Error != nil {
+			log.Printf("Failed to create category: %v", result.Error)
+			http.Error(w, "Failed to create category: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Admin %d created category %s", userID, category.Slug)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(category)
+	}
+}
+
+// UpdateCategory renames or moves a category. Items filed under it take the
+// new name.
+func UpdateCategory(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category := loadAdminCategory(db, w, r)
+		if category == nil {
+			return
+		}
+
+		// Parse the request body
+		var req CategoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if msg := applyCategoryRequest(db, req, category); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(category).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Item{}).Where("category_id = ?", category.ID).Update("category", category.Name).Error
+		})
+		if err != nil {
+			http.Error(w, "Failed to update category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(category)
+	}
+}
+
+// DeleteCategory removes a category that has no subcategories or items.
+func DeleteCategory(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category := loadAdminCategory(db, w, r)
+		if category == nil {
+			return
+		}
+
+		err := models.CheckCategoryUnused(db, category.ID)
+		if errors.Is(err, models.ErrCategoryInUse) {
+			http.Error(w, "Move this category's subcategories and items elsewhere first", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to check category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Delete the category along with the attributes it defines
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("category_id = ?", category.ID).Delete(&models.CategoryAttribute{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(category).Error
+		})
+		if err != nil {
+			http.Error(w, "Failed to delete category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type CategoryAttributeRequest struct {
+	Key      string               `json:"key"`
+	Label    string               `json:"label"`
+	Type     models.AttributeType `json:"type"`
+	Options  []string             `json:"options"`
+	Unit     string               `json:"unit"`
+	Required bool                 `json:"required"`
+}
+
+// GetCategoryAttributes returns the attributes items of a category can
+// have, including those inherited from its parents.
+func GetCategoryAttributes(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the category ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid category ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := models.FindCategory(db, uint(id), ""); err != nil {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+
+		schema, err := models.AttributeSchema(db, uint(id))
+		if err != nil {
+			http.Error(w, "Failed to fetch attributes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schema)
+	}
+}
+
+// UpdateCategoryAttributes replaces the attributes a category defines.
+// Existing item values are checked against the new schema the next time
+// each item is saved.
+func UpdateCategoryAttributes(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		category := loadAdminCategory(db, w, r)
+		if category == nil {
+			return
+		}
+
+		// Parse the request body
+		var req []CategoryAttributeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		attrs := make([]models.CategoryAttribute, 0, len(req))
+		seen := make(map[string]bool)
+		for _, a := range req {
+			attr := models.CategoryAttribute{
+				CategoryID: category.ID,
+				Key:        a.Key,
+				Label:      strings.TrimSpace(a.Label),
+				Type:       a.Type,
+				Options:    a.Options,
+				Unit:       strings.TrimSpace(a.Unit),
+				Required:   a.Required,
+			}
+			if err := attr.Normalize(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if seen[attr.Key] {
+				http.Error(w, "Attribute "+attr.Key+" is defined twice", http.StatusBadRequest)
+				return
+			}
+			seen[attr.Key] = true
+			attrs = append(attrs, attr)
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("category_id = ?", category.ID).Delete(&models.CategoryAttribute{}).Error; err != nil {
+				return err
+			}
+			if len(attrs) == 0 {
+				return nil
+			}
+			return tx.Create(&attrs).Error
+		})
+		if err != nil {
+			http.Error(w, "Failed to update attributes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(attrs)
+	}
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+type ConditionReportRequest struct {
+	Stage     models.HandoffKind `json:"stage"`
+	Rating    int                `json:"rating"`
+	Notes     string             `json:"notes"`
+	PhotoURLs []string           `json:"photoUrls"`
+}
+
+// conditionReportStatuses lists the borrow request statuses in which a report
+// for each stage may be filed.
+var conditionReportStatuses = map[models.HandoffKind][]models.Status{
+	models.HandoffPickup: {models.StatusApproved, models.StatusActive},
+	models.HandoffReturn: {models.StatusActive, models.StatusOverdue, models.StatusReturned},
+}
+
+// withdrawableReportStatuses lists the borrow request statuses in which a
+// report for each stage may still be withdrawn, that is before its handoff.
+var withdrawableReportStatuses = map[models.HandoffKind][]models.Status{
+	models.HandoffPickup: {models.StatusApproved},
+	models.HandoffReturn: {models.StatusActive, models.StatusOverdue},
+}
+
+// errReportAcknowledged refuses to withdraw a report both parties agreed on.
+var errReportAcknowledged = errors.New("a report acknowledged by both parties cannot be withdrawn")
+
+// CreateConditionReport records the condition of an item at pickup or return.
+// Either party may file it; the reporter's side is acknowledged immediately.
+func CreateConditionReport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		isBuyer := borrowRequest.BuyerID == userID
+		isSeller := borrowRequest.Item.SellerID == userID
+		if !isBuyer && !isSeller {
+			http.Error(w, "You can only report on your own loans", http.StatusForbidden)
+			return
+		}
+
+		// Parse the request body
+		var req ConditionReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		statuses, ok := conditionReportStatuses[req.Stage]
+		if !ok {
+			http.Error(w, "Stage must be either 'pickup' or 'return'", http.StatusBadRequest)
+			return
+		}
+
+		if req.Rating < 1 || req.Rating > 5 {
+			http.Error(w, "Rating must be between 1 and 5", http.StatusBadRequest)
+			return
+		}
+
+		allowed := false
+		for _, s := range statuses {
+			if borrowRequest.Status == s {
+				allowed = true
+			}
+		}
+		if !allowed {
+			http.Error(w, "A "+string(req.Stage)+" report cannot be filed for a "+string(borrowRequest.Status)+" request", http.StatusConflict)
+			return
+		}
+
+		// One report per stage; the other party acknowledges rather than
+		// filing a competing report
+		var existing int64
+		if result := db.Model(&models.ConditionReport{}).
+			Where("borrow_request_id = ? AND stage = ?", borrowRequest.ID, req.Stage).
+			Count(&existing); result.Error != nil {
+			http.Error(w, "Failed to check reports: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing > 0 {
+			http.Error(w, "A "+string(req.Stage)+" report already exists for this request", http.StatusConflict)
+			return
+		}
+
+		now := time.Now()
+		report := models.ConditionReport{
+			BorrowRequestID: borrowRequest.ID,
+			Stage:           req.Stage,
+			ReporterID:      userID,
+			Rating:          req.Rating,
+			Notes:           req.Notes,
+		}
+		if isBuyer {
+			report.BuyerAcknowledgedAt = &now
+		} else {
+			report.SellerAcknowledgedAt = &now
+		}
+		for _, url := range req.PhotoURLs {
+			if url != "" {
+				report.Photos = append(report.Photos, models.ConditionPhoto{URL: url})
+			}
+		}
+
+		// Creates the report and its photos together
+		if result := db.Create(&report); result.Error != nil {
+			log.Printf("Failed to create condition report: %v", result.Error)
+			http.Error(w, "Failed to create condition report: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Condition report %d (%s) filed for borrow request %d", report.ID, report.Stage, id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// WithdrawConditionReport lets the reporter take back a report the other
+// party has not acknowledged, so that a report nobody agrees with does not
+// hold up the handoff. Reports can only be withdrawn before the handoff.
+func WithdrawConditionReport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the report ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid condition report ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the report and its borrow request
+		var report models.ConditionReport
+		if result := db.First(&report, id); result.Error != nil {
+			http.Error(w, "Condition report not found", http.StatusNotFound)
+			return
+		}
+
+		if report.ReporterID != userID {
+			http.Error(w, "You can only withdraw your own reports", http.StatusForbidden)
+			return
+		}
+
+		var borrowRequest models.BorrowRequest
+		if result := db.First(&borrowRequest, report.BorrowRequestID); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		// Once the item has changed hands the report is the record of it
+		withdrawable := false
+		for _, s := range withdrawableReportStatuses[report.Stage] {
+			if borrowRequest.Status == s {
+				withdrawable = true
+			}
+		}
+		if !withdrawable {
+			http.Error(w, "A "+string(report.Stage)+" report cannot be withdrawn once the handoff is done", http.StatusConflict)
+			return
+		}
+
+		// Only delete it if the other party has not acknowledged it meanwhile
+		err = db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Where("id = ? AND (buyer_acknowledged_at IS NULL OR seller_acknowledged_at IS NULL)", report.ID).
+				Delete(&models.ConditionReport{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errReportAcknowledged
+			}
+			return tx.Where("condition_report_id = ?", report.ID).Delete(&models.ConditionPhoto{}).Error
+		})
+
+		if errors.Is(err, errReportAcknowledged) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to withdraw report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %d withdrew condition report %d", userID, report.ID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AcknowledgeConditionReport records that the buyer or seller agrees with a
+// condition report.
+func AcknowledgeConditionReport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the report ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid condition report ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the report and its borrow request
+		var report models.ConditionReport
+		if result := db.Preload("Photos").First(&report, id); result.Error != nil {
+			http.Error(w, "Condition report not found", http.StatusNotFound)
+			return
+		}
+
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, report.BorrowRequestID); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		now := time.Now()
+		switch userID {
+		case borrowRequest.BuyerID:
+			if report.BuyerAcknowledgedAt == nil {
+				report.BuyerAcknowledgedAt = &now
+			}
+		case borrowRequest.Item.SellerID:
+			if report.SellerAcknowledgedAt == nil {
+				report.SellerAcknowledgedAt = &now
+			}
+		default:
+			http.Error(w, "You can only acknowledge reports on your own loans", http.StatusForbidden)
+			return
+		}
+
+		if result := db.Omit("Photos").Save(&report); result.Error != nil {
+			http.Error(w, "Failed to acknowledge report: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %d acknowledged condition report %d", userID, report.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+	"resource-sharing/payments"
+)
+
+type OpenDisputeRequest struct {
+	Reason string `json:"reason"`
+}
+
+type DisputeStatementRequest struct {
+	Body string `json:"body"`
+}
+
+type DisputeEvidenceRequest struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+type ResolveDisputeRequest struct {
+	Outcome     models.DisputeOutcome `json:"outcome"`
+	ChargeCents int64                 `json:"chargeCents"`
+	Notes       string                `json:"notes"`
+}
+
+// disputableStatuses are the borrow request statuses a dispute may be opened
+// on: the item has changed hands at least once.
+var disputableStatuses = []models.Status{models.StatusActive, models.StatusOverdue, models.StatusReturned}
+
+// isAdmin reports whether the user has the admin role.
+func isAdmin(db *gorm.DB, userID uint) bool {
+	var user models.User
+	if result := db.First(&user, userID); result.Error != nil {
+		return false
+	}
+	return user.Role == models.RoleAdmin
+}
+
+// loadDispute finds the dispute named in the URL and checks that the user is
+// one of its parties or an admin. It writes the error response itself and
+// returns false on failure.
+func loadDispute(db *gorm.DB, w http.ResponseWriter, r *http.Request, userID uint, dispute *models.Dispute) bool {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid dispute ID: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if result := db.Preload("BorrowRequest.Item").
+		Preload("Statements", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("Evidence").
+		First(dispute, id); result.Error != nil {
+		http.Error(w, "Dispute not found", http.StatusNotFound)
+		return false
+	}
+
+	if dispute.BorrowRequest.BuyerID != userID && dispute.BorrowRequest.Item.SellerID != userID && !isAdmin(db, userID) {
+		http.Error(w, "You can only access disputes you are part of", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// OpenDispute lets the buyer or seller of a loan raise a dispute. The item is
+// frozen until the dispute is resolved.
+func OpenDispute(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		if borrowRequest.BuyerID != userID && borrowRequest.Item.SellerID != userID {
+			http.Error(w, "You can only open disputes on your own loans", http.StatusForbidden)
+			return
+		}
+
+		disputable := false
+		for _, s := range disputableStatuses {
+			if borrowRequest.Status == s {
+				disputable = true
+			}
+		}
+		if !disputable {
+			http.Error(w, "Disputes can only be opened once the item has been picked up", http.StatusConflict)
+			return
+		}
+
+		// Parse the request body
+		var req OpenDisputeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Reason == "" {
+			http.Error(w, "Reason is required", http.StatusBadRequest)
+			return
+		}
+
+		var open int64
+		if result := db.Model(&models.Dispute{}).
+			Where("borrow_request_id = ? AND status = ?", borrowRequest.ID, models.StatusOpen).
+			Count(&open); result.Error != nil {
+			http.Error(w, "Failed to check disputes: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if open > 0 {
+			http.Error(w, "A dispute is already open for this loan", http.StatusConflict)
+			return
+		}
+
+		dispute := models.Dispute{
+			BorrowRequestID: borrowRequest.ID,
+			OpenedByID:      userID,
+			Reason:          req.Reason,
+			Status:          models.StatusOpen,
+		}
+
+		// Open the dispute and freeze the item in a transaction
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&dispute).Error; err != nil {
+				return err
+			}
+			return models.FreezeItem(tx, &borrowRequest.Item)
+		})
+
+		if err != nil {
+			log.Printf("Failed to open dispute: %v", err)
+			http.Error(w, "Failed to open dispute: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %d opened dispute %d on borrow request %d", userID, dispute.ID, id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dispute)
+	}
+}
+
+// GetDisputes lists all open disputes for admins, and the user's own disputes
+// for everyone else.
+func GetDisputes(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		page, err := parsePageRequest(r, disputeSortKeys, "createdAt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.Dispute{})
+		if isAdmin(db, userID) {
+			query = query.Where("disputes.status = ?", models.StatusOpen)
+		} else {
+			query = query.Joins("JOIN borrow_requests ON disputes.borrow_request_id = borrow_requests.id").
+				Joins("JOIN items ON borrow_requests.item_id = items.id").
+				Where("borrow_requests.buyer_id = ? OR items.seller_id = ?", userID, userID)
+		}
+		query = query.Session(&gorm.Session{})
+		total, err := page.countTotal(query)
+		if err != nil {
+			http.Error(w, "Failed to count disputes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		paged, err := page.apply(query, "disputes.id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var disputes []models.Dispute
+		if result := paged.Preload("BorrowRequest.Item").Find(&disputes); result.Error != nil {
+			http.Error(w, "Failed to fetch disputes: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := PageResponse{Items: disputes, Total: total}
+		if page.hasMore(len(disputes)) {
+			disputes = disputes[:page.limit]
+			last := disputes[len(disputes)-1]
+			response.Items = disputes
+			response.NextCursor = page.nextCursor(last.CreatedAt, last.ID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func GetDispute(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var dispute models.Dispute
+		if !loadDispute(db, w, r, userID, &dispute) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dispute)
+	}
+}
+
+// AddDisputeStatement appends a statement from a party or the admin to an
+// open dispute.
+func AddDisputeStatement(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var dispute models.Dispute
+		if !loadDispute(db, w, r, userID, &dispute) {
+			return
+		}
+
+		if dispute.Status != models.StatusOpen {
+			http.Error(w, "Dispute is already resolved", http.StatusConflict)
+			return
+		}
+
+		// Parse the request body
+		var req DisputeStatementRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Body == "" {
+			http.Error(w, "Statement body is required", http.StatusBadRequest)
+			return
+		}
+
+		statement := models.DisputeStatement{
+			DisputeID: dispute.ID,
+			AuthorID:  userID,
+			Body:      req.Body,
+		}
+
+		if result := db.Create(&statement); result.Error != nil {
+			http.Error(w, "Failed to add statement: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statement)
+	}
+}
+
+// AddDisputeEvidence attaches a file URL to an open dispute.
+func AddDisputeEvidence(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var dispute models.Dispute
+		if !loadDispute(db, w, r, userID, &dispute) {
+			return
+		}
+
+		if dispute.Status != models.StatusOpen {
+			http.Error(w, "Dispute is already resolved", http.StatusConflict)
+			return
+		}
+
+		// Parse the request body
+		var req DisputeEvidenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.URL == "" {
+			http.Error(w, "Evidence URL is required", http.StatusBadRequest)
+			return
+		}
+
+		evidence := models.DisputeEvidence{
+			DisputeID:     dispute.ID,
+			SubmittedByID: userID,
+			URL:           req.URL,
+			Description:   req.Description,
+		}
+
+		if result := db.Create(&evidence); result.Error != nil {
+			http.Error(w, "Failed to add evidence: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(evidence)
+	}
+}
+
+// errDisputeResolved refuses to resolve a dispute that a concurrent request
+// resolved already.
+var errDisputeResolved = errors.New("dispute is already resolved")
+
+// ResolveDispute lets an admin close a dispute with an outcome. Any charge is
+// deducted from the deposit before the rest is refunded, and the item is
+// unfrozen once no other dispute on it is open.
+func ResolveDispute(db *gorm.DB, processor payments.Processor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if !isAdmin(db, userID) {
+			http.Error(w, "Only admins can resolve disputes", http.StatusForbidden)
+			return
+		}
+
+		var dispute models.Dispute
+		if !loadDispute(db, w, r, userID, &dispute) {
+			return
+		}
+
+		if dispute.Status != models.StatusOpen {
+			http.Error(w, "Dispute is already resolved", http.StatusConflict)
+			return
+		}
+
+		// Parse the request body
+		var req ResolveDisputeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch req.Outcome {
+		case models.OutcomeNoFault, models.OutcomeFullCharge:
+			req.ChargeCents = 0
+		case models.OutcomePartialCharge:
+			if req.ChargeCents <= 0 {
+				http.Error(w, "A partial charge needs a positive amount", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Outcome must be 'no_fault', 'partial_charge' or 'full_charge'", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		dispute.Status = models.StatusResolved
+		dispute.Outcome = req.Outcome
+		dispute.ChargeCents = req.ChargeCents
+		dispute.ResolutionNotes = req.Notes
+		dispute.ResolvedByID = &userID
+		dispute.ResolvedAt = &now
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Hold the item and the loan, in the order returns take them, so
+			// a concurrent return either settles the deposit first or sees
+			// the dispute resolved
+			if err := models.LockRelatedItems(tx, &dispute.BorrowRequest.Item); err != nil {
+				return err
+			}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").
+				First(&dispute.BorrowRequest, dispute.BorrowRequestID).Error; err != nil {
+				return err
+			}
+
+			// Only an open dispute is resolved, so a second submission
+			// cannot settle the deposit again
+			result := tx.Model(&models.Dispute{}).
+				Where("id = ? AND status = ?", dispute.ID, models.StatusOpen).
+				Updates(map[string]interface{}{
+					"status":           dispute.Status,
+					"outcome":          dispute.Outcome,
+					"charge_cents":     dispute.ChargeCents,
+					"resolution_notes": dispute.ResolutionNotes,
+					"resolved_by_id":   dispute.ResolvedByID,
+					"resolved_at":      dispute.ResolvedAt,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errDisputeResolved
+			}
+
+			// The deposit is only settled here if the loan already ended;
+			// otherwise the return does it
+			if dispute.BorrowRequest.Status == models.StatusReturned {
+				if err := payments.SettleDeposit(tx, &dispute.BorrowRequest, dispute.Charge(&dispute.BorrowRequest)); err != nil {
+					return err
+				}
+			}
+			if err := models.UnfreezeItem(tx, &dispute.BorrowRequest.Item); err != nil {
+				return err
+			}
+			// Waitlisted buyers get their turn once the item is free again
+			if dispute.BorrowRequest.Item.Status != models.StatusAvailable {
+				return nil
+			}
+			_, err := models.OfferNextWaitlistEntry(tx, dispute.BorrowRequest.ItemID, now, WaitlistClaimWindow)
+			return err
+		})
+
+		if errors.Is(err, errDisputeResolved) {
+			http.Error(w, "Dispute is already resolved", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to resolve dispute: %v", err)
+			http.Error(w, "Failed to resolve dispute: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := payments.Flush(db, processor, dispute.BorrowRequestID); err != nil {
+			log.Printf("Payments for borrow request %d left pending: %v", dispute.BorrowRequestID, err)
+		}
+
+		log.Printf("Admin %d resolved dispute %d as %s", userID, dispute.ID, dispute.Outcome)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dispute)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"resource-sharing/models"
+)
+
+// writeTransitionError reports a rejected borrow request status change. Every
+// invalid transition is answered with 409 Conflict.
+func writeTransitionError(w http.ResponseWriter, id int, err error) {
+	log.Printf("Invalid transition for request %d: %v", id, err)
+	http.Error(w, err.Error(), http.StatusConflict)
+}
+
+// Error codes sent in the X-Error-Code header so clients can tell refusals
+// apart without parsing the message.
+const (
+	ErrorCodeBuyerBlocked     = "buyer_blocked"
+	ErrorCodeLoanLimitReached = "loan_limit_reached"
+)
+
+// writeCodedError writes a plain-text error like http.Error and tags it with
+// code in the X-Error-Code header.
+func writeCodedError(w http.ResponseWriter, code, message string, status int) {
+	w.Header().Set("X-Error-Code", code)
+	http.Error(w, message, status)
+}
+
+// writeBorrowingLimitError reports a request refused by
+// models.CheckBorrowingLimits. It returns false if err is not such a refusal.
+func writeBorrowingLimitError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrBuyerBlocked):
+		writeCodedError(w, ErrorCodeBuyerBlocked, err.Error(), http.StatusForbidden)
+	case errors.Is(err, models.ErrLoanLimitReached):
+		writeCodedError(w, ErrorCodeLoanLimitReached, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+	"resource-sharing/payments"
+)
+
+type ExtensionRequest struct {
+	EndDate time.Time `json:"endDate"`
+	Message string    `json:"message"`
+}
+
+// onLoanStatuses are the borrow request statuses that can be extended.
+var onLoanStatuses = []models.Status{models.StatusApproved, models.StatusActive, models.StatusOverdue}
+
+func isOnLoan(status models.Status) bool {
+	for _, s := range onLoanStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// errExtensionDecided refuses a decision on an extension that was
+	// decided by a concurrent request.
+	errExtensionDecided = errors.New("only pending extensions can be decided")
+	// errLoanChanged refuses an extension of a loan whose status or end
+	// date changed since the extension was requested.
+	errLoanChanged = errors.New("the loan has changed since this extension was requested")
+)
+
+// decideExtension moves a pending extension to status, together with the
+// fields of its decision. It fails with errExtensionDecided if the extension
+// is no longer pending, so two concurrent decisions cannot both apply.
+func decideExtension(db *gorm.DB, extension *models.LoanExtension, status models.Status) error {
+	result := db.Model(extension).
+		Where("status = ?", models.StatusPending).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"denial_reason": extension.DenialReason,
+			"decided_at":    extension.DecidedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errExtensionDecided
+	}
+	extension.Status = status
+	return nil
+}
+
+// RequestLoanExtension lets the buyer propose a later end date for a loan.
+func RequestLoanExtension(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			log.Printf("Invalid borrow request ID: %v", err)
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			log.Printf("Borrow request not found: %v", result.Error)
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the user is the buyer
+		if borrowRequest.BuyerID != userID {
+			log.Printf("User %d is not the buyer of request %d", userID, id)
+			http.Error(w, "You can only extend your own loans", http.StatusForbidden)
+			return
+		}
+
+		if !isOnLoan(borrowRequest.Status) {
+			log.Printf("Request %d is not on loan (status: %s)", id, borrowRequest.Status)
+			http.Error(w, "Only approved loans can be extended", http.StatusConflict)
+			return
+		}
+
+		// Parse the request body
+		var req ExtensionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Failed to decode request body: %v", err)
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !req.EndDate.After(borrowRequest.EndDate) {
+			http.Error(w, "New end date must be after the current end date", http.StatusBadRequest)
+			return
+		}
+
+		// Only one extension may be open at a time
+		var pending int64
+		if result := db.Model(&models.LoanExtension{}).
+			Where("borrow_request_id = ? AND status = ?", borrowRequest.ID, models.StatusPending).
+			Count(&pending); result.Error != nil {
+			http.Error(w, "Failed to check extensions: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if pending > 0 {
+			http.Error(w, "An extension for this loan is already awaiting a decision", http.StatusConflict)
+			return
+		}
+
+		// The extended loan must still respect the item's duration and must
+		// not run into a later reservation
+		if err := borrowRequest.Item.CheckLoanLength(borrowRequest.StartDate, req.EndDate); err != nil {
+			log.Printf("Extension for request %d violates loan policy: %v", id, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = models.CheckCapacity(db, &borrowRequest.Item, borrowRequest.EndDate, req.EndDate, borrowRequest.Quantity, borrowRequest.ID)
+		if errors.Is(err, models.ErrNotEnoughRoom) {
+			log.Printf("Extension for request %d overlaps other bookings", id)
+			http.Error(w, "Item is already booked for the requested dates", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to check for conflicting requests: %v", err)
+			http.Error(w, "Failed to check availability: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		extension := models.LoanExtension{
+			BorrowRequestID:  borrowRequest.ID,
+			PreviousEndDate:  borrowRequest.EndDate,
+			RequestedEndDate: req.EndDate,
+			Status:           models.StatusPending,
+			Message:          req.Message,
+		}
+
+		if result := db.Create(&extension); result.Error != nil {
+			log.Printf("Failed to create extension: %v", result.Error)
+			http.Error(w, "Failed to create extension: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Extension %d requested for borrow request %d", extension.ID, id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(extension)
+	}
+}
+
+// GetLoanExtensions returns the extension history of a loan to its buyer or
+// seller.
+func GetLoanExtensions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		if borrowRequest.BuyerID != userID && borrowRequest.Item.SellerID != userID {
+			http.Error(w, "You can only view extensions of your own loans", http.StatusForbidden)
+			return
+		}
+
+		var extensions []models.LoanExtension
+		if result := db.Where("borrow_request_id = ?", borrowRequest.ID).Order("created_at").Find(&extensions); result.Error != nil {
+			http.Error(w, "Failed to fetch extensions: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(extensions)
+	}
+}
+
+// ApproveLoanExtension lets the seller accept a pending extension, moving the
+// loan's end date. A loan already picked up is charged the fee for the added
+// days.
+func ApproveLoanExtension(db *gorm.DB, processor payments.Processor) http.HandlerFunc {
+	return decideLoanExtension(db, processor, true)
+}
+
+// DenyLoanExtension lets the seller reject a pending extension, optionally
+// with a reason.
+func DenyLoanExtension(db *gorm.DB) http.HandlerFunc {
+	return decideLoanExtension(db, nil, false)
+}
+
+func decideLoanExtension(db *gorm.DB, processor payments.Processor, approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request and extension IDs from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		extensionID, err := strconv.Atoi(vars["extensionId"])
+		if err != nil {
+			http.Error(w, "Invalid extension ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request and the extension
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		var extension models.LoanExtension
+		if result := db.Where("borrow_request_id = ?", borrowRequest.ID).First(&extension, extensionID); result.Error != nil {
+			http.Error(w, "Extension not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the user is the seller of the item
+		if borrowRequest.Item.SellerID != userID {
+			log.Printf("User %d is not the seller of item %d", userID, borrowRequest.Item.ID)
+			http.Error(w, "You can only decide extensions for your own items", http.StatusForbidden)
+			return
+		}
+
+		if extension.Status != models.StatusPending {
+			http.Error(w, "Only pending extensions can be decided", http.StatusConflict)
+			return
+		}
+
+		now := time.Now()
+		extension.DecidedAt = &now
+
+		if !approve {
+			// The reason is optional, so an empty body is fine
+			var req DenyRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+				http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			extension.DenialReason = req.Reason
+
+			err := decideExtension(db, &extension, models.StatusDenied)
+			if errors.Is(err, errExtensionDecided) {
+				http.Error(w, "Only pending extensions can be decided", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to deny extension: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			log.Printf("Denied extension %d of borrow request %d", extension.ID, id)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(extension)
+			return
+		}
+
+		if !isOnLoan(borrowRequest.Status) || !borrowRequest.EndDate.Equal(extension.PreviousEndDate) {
+			http.Error(w, "The loan has changed since this extension was requested", http.StatusConflict)
+			return
+		}
+
+		// An overdue loan that gets a new future end date is back on time
+		loanStatus := borrowRequest.Status
+		if borrowRequest.Status == models.StatusOverdue && extension.RequestedEndDate.After(now) {
+			if err := borrowRequest.TransitionTo(models.StatusActive, models.ActorSeller); err != nil {
+				writeTransitionError(w, id, err)
+				return
+			}
+			borrowRequest.OverdueAt = nil
+		}
+
+		borrowRequest.EndDate = extension.RequestedEndDate
+		borrowRequest.RemindersSent = 0
+
+		reason := "Automatically denied: the current borrower's loan was extended over these dates"
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Re-check for reservations made since the extension was
+			// requested, holding the item so no approval takes the dates
+			if err := models.LockRelatedItems(tx, &borrowRequest.Item); err != nil {
+				return err
+			}
+			// Hold the loan too, so a concurrent decision or return waits
+			// and then sees the new end date
+			var current models.BorrowRequest
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status", "end_date").First(&current, borrowRequest.ID).Error; err != nil {
+				return err
+			}
+			if current.Status != loanStatus || !current.EndDate.Equal(extension.PreviousEndDate) {
+				return errLoanChanged
+			}
+			if err := models.CheckCapacity(tx, &borrowRequest.Item, extension.PreviousEndDate, extension.RequestedEndDate, borrowRequest.Quantity, borrowRequest.ID); err != nil {
+				return err
+			}
+
+			if err := decideExtension(tx, &extension, models.StatusApproved); err != nil {
+				return err
+			}
+			if err := tx.Model(&borrowRequest).
+				Select("status", "overdue_at", "end_date", "reminders_sent").
+				Updates(&borrowRequest).Error; err != nil {
+				return err
+			}
+			if _, err := models.DenyOverlappingPending(tx, &borrowRequest, reason); err != nil {
+				return err
+			}
+			// Loans not yet picked up pay for the new dates at pickup
+			if borrowRequest.PickedUpAt == nil {
+				return nil
+			}
+			return payments.ChargeExtension(tx, &borrowRequest, extension.PreviousEndDate)
+		})
+
+		if errors.Is(err, models.ErrNotEnoughRoom) {
+			http.Error(w, "Item is already booked for the requested dates", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, errExtensionDecided) {
+			http.Error(w, "Only pending extensions can be decided", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, errLoanChanged) {
+			http.Error(w, "The loan has changed since this extension was requested", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to approve extension: %v", err)
+			http.Error(w, "Failed to approve extension: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := payments.Flush(db, processor, borrowRequest.ID); err != nil {
+			log.Printf("Payments for borrow request %d left pending: %v", id, err)
+		}
+
+		log.Printf("Approved extension %d of borrow request %d", extension.ID, id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(extension)
+	}
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+	"resource-sharing/payments"
+)
+
+type HandoffCodeRequest struct {
+	// Code is either the six digit code or the scanned QR payload.
+	Code string `json:"code"`
+}
+
+type HandoffCodesResponse struct {
+	PickupCode    string `json:"pickupCode,omitempty"`
+	PickupPayload string `json:"pickupPayload,omitempty"`
+	ReturnCode    string `json:"returnCode,omitempty"`
+	ReturnPayload string `json:"returnPayload,omitempty"`
+}
+
+// GetHandoffCodes reveals the current pickup or return code to the buyer so
+// they can show it to the seller. A handoff locked by too many wrong codes is
+// unlocked with a fresh code, so guessing needs the buyer's help every
+// MaxHandoffAttempts tries.
+func GetHandoffCodes(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		// Only the buyer may see the codes
+		if borrowRequest.BuyerID != userID {
+			http.Error(w, "You can only view handoff codes for your own loans", http.StatusForbidden)
+			return
+		}
+
+		if borrowRequest.HandoffAttempts >= models.MaxHandoffAttempts {
+			if err := rotateHandoffCode(db, &borrowRequest); err != nil {
+				http.Error(w, "Failed to issue a new handoff code: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		var resp HandoffCodesResponse
+		switch borrowRequest.Status {
+		case models.StatusApproved:
+			resp.PickupCode = borrowRequest.PickupCode
+			resp.PickupPayload = models.HandoffPayload(models.HandoffPickup, borrowRequest.ID, borrowRequest.PickupCode)
+		case models.StatusActive, models.StatusOverdue:
+			resp.ReturnCode = borrowRequest.ReturnCode
+			resp.ReturnPayload = models.HandoffPayload(models.HandoffReturn, borrowRequest.ID, borrowRequest.ReturnCode)
+		default:
+			http.Error(w, "This request has no open handoff", http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// rotateHandoffCode replaces the open handoff code of a request and clears its
+// attempts.
+func rotateHandoffCode(db *gorm.DB, br *models.BorrowRequest) error {
+	code, err := models.GenerateHandoffCode()
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"handoff_attempts": 0}
+	switch br.Status {
+	case models.StatusApproved:
+		br.PickupCode = code
+		updates["pickup_code"] = code
+	case models.StatusActive, models.StatusOverdue:
+		br.ReturnCode = code
+		updates["return_code"] = code
+	}
+	br.HandoffAttempts = 0
+	return db.Model(br).Updates(updates).Error
+}
+
+// writeHandoffMismatch reports a handoff code that failed to match, or an
+// attempt refused because the handoff is locked.
+func writeHandoffMismatch(w http.ResponseWriter, id int, kind models.HandoffKind, err error) {
+	if errors.Is(err, models.ErrHandoffLocked) {
+		log.Printf("Too many %s codes entered for request %d", kind, id)
+		http.Error(w, "Too many wrong codes; ask the buyer to open their code again", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to count %s code attempt for request %d: %v", kind, id, err)
+		http.Error(w, "Failed to check code: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Wrong %s code for request %d", kind, id)
+	http.Error(w, "The "+string(kind)+" code does not match", http.StatusBadRequest)
+}
+
+// writeReportError reports a handoff held up by an unacknowledged condition
+// report, or a failure to check for one.
+func writeReportError(w http.ResponseWriter, id int, err error) {
+	if errors.Is(err, models.ErrReportUnacknowledged) {
+		log.Printf("Condition report of request %d is not acknowledged yet", id)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("Failed to check condition reports of request %d: %v", id, err)
+	http.Error(w, "Failed to check condition reports: "+err.Error(), http.StatusInternalServerError)
+}
+
+// ConfirmPickup lets the seller start a loan by entering the buyer's pickup
+// code at handoff. The item's deposit is held and the loan fee charged. A
+// pickup condition report, if filed, must be acknowledged by both parties.
+func ConfirmPickup(db *gorm.DB, processor payments.Processor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			log.Printf("Invalid borrow request ID: %v", err)
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Confirming pickup of borrow request ID: %d for user ID: %d", id, userID)
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			log.Printf("Borrow request not found: %v", result.Error)
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the user is the seller of the item
+		if borrowRequest.Item.SellerID != userID {
+			log.Printf("User %d is not the seller of item %d", userID, borrowRequest.Item.ID)
+			http.Error(w, "You can only confirm pickups for your own items", http.StatusForbidden)
+			return
+		}
+
+		// Parse the request body
+		var req HandoffCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Items under dispute cannot be handed out
+		if borrowRequest.Item.Status == models.StatusFrozen {
+			http.Error(w, "Item is unavailable while a dispute is open", http.StatusConflict)
+			return
+		}
+
+		// Move the request to active
+		if err := borrowRequest.TransitionTo(models.StatusActive, models.ActorSeller); err != nil {
+			writeTransitionError(w, id, err)
+			return
+		}
+
+		// Both parties must agree on the condition the item changed hands in
+		if err := models.CheckReportAcknowledged(db, borrowRequest.ID, models.HandoffPickup); err != nil {
+			writeReportError(w, id, err)
+			return
+		}
+
+		if err := models.UseHandoffAttempt(db, borrowRequest.ID); err != nil {
+			writeHandoffMismatch(w, id, models.HandoffPickup, err)
+			return
+		}
+		if !models.MatchHandoffCode(models.HandoffPickup, borrowRequest.ID, borrowRequest.PickupCode, req.Code) {
+			writeHandoffMismatch(w, id, models.HandoffPickup, nil)
+			return
+		}
+
+		returnCode, err := models.GenerateHandoffCode()
+		if err != nil {
+			http.Error(w, "Failed to generate return code: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		borrowRequest.PickedUpAt = &now
+		borrowRequest.PickupCode = ""
+		borrowRequest.ReturnCode = returnCode
+		borrowRequest.HandoffAttempts = 0
+
+		// Save the changes in a transaction
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Hold the item while picking units, and make sure a concurrent
+			// confirmation has not started the loan already
+			if err := models.LockRelatedItems(tx, &borrowRequest.Item); err != nil {
+				return err
+			}
+			if err := models.LockTransition(tx, borrowRequest.ID, models.StatusActive, models.ActorSeller); err != nil {
+				return err
+			}
+			if err := tx.Model(&borrowRequest).
+				Select("status", "picked_up_at", "pickup_code", "return_code", "handoff_attempts").
+				Updates(&borrowRequest).Error; err != nil {
+				return err
+			}
+
+			// The item only counts as borrowed once all its units are out
+			if err := models.AssignUnits(tx, &borrowRequest); err != nil {
+				return err
+			}
+			status, err := models.UnitStatus(tx, &borrowRequest.Item)
+			if err != nil {
+				return err
+			}
+			borrowRequest.Item.Status = status
+			if err := tx.Model(&borrowRequest.Item).Update("status", status).Error; err != nil {
+				return err
+			}
+			return payments.CollectAtPickup(tx, &borrowRequest)
+		})
+
+		if errors.Is(err, models.ErrInvalidTransition) {
+			writeTransitionError(w, id, err)
+			return
+		}
+		if errors.Is(err, models.ErrNoUnitsFree) {
+			log.Printf("No free units to hand out for request %d", id)
+			http.Error(w, "Not enough units of this item are available to hand out", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to confirm pickup: %v", err)
+			http.Error(w, "Failed to confirm pickup: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The loan has started either way; a failed payment stays pending
+		// for the payments job to retry
+		if err := payments.Flush(db, processor, borrowRequest.ID); err != nil {
+			log.Printf("Payments for borrow request %d left pending: %v", id, err)
+		}
+
+		log.Printf("Successfully confirmed pickup of borrow request %d", id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(borrowRequest)
+	}
+}
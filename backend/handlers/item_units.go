@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+type ItemUnitRequest struct {
+	Label string `json:"label"`
+	// Status moves a unit into or out of maintenance. Borrowed units
+	// cannot be changed.
+	Status    models.Status `json:"status"`
+	Condition int           `json:"condition"`
+	Notes     string        `json:"notes"`
+}
+
+// GetItemUnits lists the units of an item.
+func GetItemUnits(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the item ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		// Find the item
+		var item models.Item
+		if result := db.First(&item, id); result.Error != nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+
+		var units []models.ItemUnit
+		if result := db.Where("item_id = ?", item.ID).Order("id").Find(&units); result.Error != nil {
+			http.Error(w, "Failed to fetch units: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(units)
+	}
+}
+
+// UpdateItemUnit lets the seller relabel a unit, record its condition or put
+// it into maintenance.
+func UpdateItemUnit(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the item and unit IDs from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+		unitID, err := strconv.Atoi(vars["unitId"])
+		if err != nil {
+			http.Error(w, "Invalid unit ID", http.StatusBadRequest)
+			return
+		}
+
+		// Find the item
+		var item models.Item
+		if result := db.First(&item, id); result.Error != nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the user is the seller of the item
+		if item.SellerID != userID {
+			http.Error(w, "You can only update units of your own items", http.StatusForbidden)
+			return
+		}
+
+		var unit models.ItemUnit
+		if result := db.Where("item_id = ?", item.ID).First(&unit, unitID); result.Error != nil {
+			http.Error(w, "Unit not found", http.StatusNotFound)
+			return
+		}
+
+		// Parse the request body
+		var req ItemUnitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Condition < 0 || req.Condition > 5 {
+			http.Error(w, "Condition must be between 0 and 5", http.StatusBadRequest)
+			return
+		}
+
+		if req.Status != "" && req.Status != unit.Status {
+			if unit.Status == models.StatusBorrowed {
+				http.Error(w, "A unit on loan cannot change status until it is returned", http.StatusConflict)
+				return
+			}
+			if req.Status != models.StatusAvailable && req.Status != models.StatusMaintenance {
+				http.Error(w, "Status must be available or maintenance", http.StatusBadRequest)
+				return
+			}
+			unit.Status = req.Status
+		}
+
+		if req.Label != "" {
+			unit.Label = req.Label
+		}
+		unit.Condition = req.Condition
+		unit.Notes = req.Notes
+
+		// Units can only go into maintenance if upcoming loans still fit in
+		// the rest
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := models.LockRelatedItems(tx, &item); err != nil {
+				return err
+			}
+			if err := tx.Save(&unit).Error; err != nil {
+				return err
+			}
+			if unit.Status != models.StatusMaintenance {
+				return nil
+			}
+			return models.CheckBookingsFit(tx, &item, time.Now())
+		})
+
+		if errors.Is(err, models.ErrNotEnoughRoom) {
+			http.Error(w, "Upcoming loans need this unit; it cannot go into maintenance", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update unit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(unit)
+	}
+}
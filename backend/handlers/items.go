@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 
+	"resource-sharing/geo"
 	"resource-sharing/middleware"
 	"resource-sharing/models"
 )
@@ -18,8 +22,56 @@ type ItemRequest struct {
 	Description string `json:"description"`
 	Category    string `json:"category"`
 	ImageURL    string `json:"imageUrl"`
+	// CategoryID picks the item's category. Category may name it by slug
+	// or name instead.
+	CategoryID uint `json:"categoryId"`
 	Location    string `json:"location"`
 	Duration    int    `json:"duration"`
+	// Address is the exact pickup address. Latitude and Longitude pin it on
+	// the map; without them the address is geocoded. Omitting it leaves an
+	// existing item's address and position unchanged.
+	Address   *string  `json:"address"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	// Quantity is the number of identical units. Zero means one for a new
+	// item and leaves an existing item unchanged.
+	Quantity int `json:"quantity"`
+	MinNoticeDays  int `json:"minNoticeDays"`
+	MaxAdvanceDays int `json:"maxAdvanceDays"`
+	CancellationWindowHours int `json:"cancellationWindowHours"`
+	DepositCents  int64 `json:"depositCents"`
+	DailyFeeCents int64 `json:"dailyFeeCents"`
+	// ComponentIDs makes a new item a bundle of these items. On update it
+	// replaces a bundle's components; nil leaves them unchanged.
+	ComponentIDs []uint `json:"componentIds"`
+	// Tags are free-form labels and Attributes the values of the typed
+	// attributes the category defines. On update nil leaves them unchanged.
+	Tags       []string               `json:"tags"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// isItemDetailError reports whether err is a problem with the tags or
+// attribute values of an item request rather than a database failure.
+func isItemDetailError(err error) bool {
+	return errors.Is(err, models.ErrTooManyTags) || errors.Is(err, models.ErrInvalidAttribute)
+}
+
+// itemTagsAndAttributes normalizes the request's tags and validates its
+// attribute values against the schema of the category.
+func itemTagsAndAttributes(db *gorm.DB, categoryID uint, tags []string, values map[string]interface{}) ([]string, []models.ItemAttribute, error) {
+	tags, err := models.NormalizeTags(tags)
+	if err != nil {
+		return nil, nil, err
+	}
+	schema, err := models.AttributeSchema(db, categoryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	attrs, err := models.BuildItemAttributes(schema, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tags, attrs, nil
 }
 
 func GetItems(db *gorm.DB) http.HandlerFunc {
@@ -28,12 +80,44 @@ func GetItems(db *gorm.DB) http.HandlerFunc {
         category := r.URL.Query().Get("category")
         status := r.URL.Query().Get("status")
         location := r.URL.Query().Get("location")
+        kind := r.URL.Query().Get("kind")
+        q := strings.TrimSpace(r.URL.Query().Get("q"))
+        center, radius, err := parseNear(r)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+
+        // Radius searches are ordered by distance and text searches by
+        // relevance unless asked otherwise
+        defaultSort := "-createdAt"
+        if center != nil {
+            defaultSort = "distance"
+        } else if q != "" {
+            defaultSort = "relevance"
+        }
+        page, err := parsePageRequest(r, itemListSortKeys(q != "", center != nil), defaultSort)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
 
         // Build the query
-        query := db.Model(&models.Item{}).Preload("Seller")
+        query := db.Model(&models.Item{})
 
+        // Filtering by a category includes its subcategories
         if category != "" {
-            query = query.Where("category = ?", category)
+            ids := []uint{}
+            found, err := models.FindCategory(db, 0, category)
+            if err == nil {
+                ids, err = models.CategoryAndDescendants(db, found.ID)
+            }
+            if err != nil && !errors.Is(err, models.ErrUnknownCategory) {
+                log.Printf("Error loading category %q: %v", category, err)
+                http.Error(w, "Failed to load category: "+err.Error(), http.StatusInternalServerError)
+                return
+            }
+            query = query.Where("category_id IN ?", ids)
         }
 
         if status != "" {
@@ -44,13 +128,89 @@ func GetItems(db *gorm.DB) http.HandlerFunc {
             query = query.Where("location LIKE ?", "%"+location+"%")
         }
 
-        // Execute the query
+        if kind != "" {
+            query = query.Where("kind = ?", kind)
+        }
+
+        // Every tag and attribute filter must match
+        for _, tag := range r.URL.Query()["tag"] {
+            query = models.TaggedWith(query, tag)
+        }
+        for param, values := range r.URL.Query() {
+            if key := strings.TrimPrefix(param, "attr."); key != param {
+                for _, value := range values {
+                    query = models.WithAttribute(query, key, value)
+                }
+            }
+        }
+
+        // Free-text search over title, description and category
+        if q != "" {
+            query = models.SearchItems(query, q)
+        }
+
+        if center != nil {
+            query = models.ItemsNear(query, *center, radius)
+        }
+        query = query.Session(&gorm.Session{})
+
+        total, err := page.countTotal(query)
+        if err != nil {
+            log.Printf("Error counting items: %v", err)
+            http.Error(w, "Failed to count items: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        // Execute the query for this page only, so sellers are only loaded
+        // for the rows returned
         var items []models.Item
-        if result := query.Find(&items); result.Error != nil {
-            log.Printf("Error fetching items: %v", result.Error)
-            http.Error(w, "Failed to fetch items: "+result.Error.Error(), http.StatusInternalServerError)
+        preloaded := query.Preload("Seller").Preload("Components").Preload("Tags").Preload("Attributes")
+        if page.key.kind == sortOffset {
+            offset := 0
+            if page.after != nil {
+                offset = page.after.Offset
+            }
+            if page.sort == "distance" {
+                if q != "" {
+                    preloaded = models.WithSearchRank(preloaded, q)
+                }
+                items, err = models.NearestItems(preloaded, *center, radius, offset, page.limit+1)
+                if q != "" {
+                    models.ScoreSearchResults(db, items, q)
+                }
+            } else {
+                items, err = models.RankedSearch(preloaded, q, offset, page.limit+1)
+            }
+        } else {
+            paged, pageErr := page.apply(preloaded, "items.id")
+            if pageErr != nil {
+                http.Error(w, pageErr.Error(), http.StatusBadRequest)
+                return
+            }
+            if q != "" {
+                paged = models.WithSearchRank(paged, q)
+            }
+            err = paged.Find(&items).Error
+            if q != "" {
+                models.ScoreSearchResults(db, items, q)
+            }
+        }
+        if err != nil {
+            log.Printf("Error fetching items: %v", err)
+            http.Error(w, "Failed to fetch items: "+err.Error(), http.StatusInternalServerError)
             return
         }
+        if center != nil {
+            models.SetDistances(items, *center)
+        }
+
+        response := PageResponse{Items: items, Total: total}
+        if page.hasMore(len(items)) {
+            items = items[:page.limit]
+            last := items[len(items)-1]
+            response.Items = items
+            response.NextCursor = page.nextCursor(itemSortValue(page, &last), last.ID)
+        }
         
         log.Printf("Found %d items", len(items))
         
@@ -63,9 +223,9 @@ func GetItems(db *gorm.DB) http.HandlerFunc {
             }
         }
 
-        // Return the items
+        // Return the page of items
         w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(items)
+        json.NewEncoder(w).Encode(response)
     }
 }
 
@@ -81,7 +241,7 @@ func GetItem(db *gorm.DB) http.HandlerFunc {
 
 		// Find the item
 		var item models.Item
-		if result := db.Preload("Seller").First(&item, id); result.Error != nil {
+		if result := db.Preload("Seller").Preload("Components").Preload("Tags").Preload("Attributes").First(&item, id); result.Error != nil {
 			http.Error(w, "Item not found", http.StatusNotFound)
 			return
 		}
@@ -92,7 +252,7 @@ func GetItem(db *gorm.DB) http.HandlerFunc {
 	}
 }
 
-func CreateItem(db *gorm.DB) http.HandlerFunc {
+func CreateItem(db *gorm.DB, geocoder geo.Geocoder) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         // Get the user ID from the context
         userID, ok := middleware.GetUserIDFromContext(r)
@@ -129,29 +289,117 @@ func CreateItem(db *gorm.DB) http.HandlerFunc {
         log.Printf("Item request: %+v", req)
 
         // Validate input
-        if req.Title == "" || req.Category == "" || req.Duration <= 0 {
+        if req.Title == "" || (req.Category == "" && req.CategoryID == 0) || req.Duration <= 0 {
             log.Println("Invalid request: missing required fields")
             http.Error(w, "Title, category, and duration are required", http.StatusBadRequest)
             return
         }
 
+        category, err := models.FindCategory(db, req.CategoryID, req.Category)
+        if errors.Is(err, models.ErrUnknownCategory) {
+            log.Printf("Invalid request: unknown category %q", req.Category)
+            http.Error(w, "Unknown category", http.StatusBadRequest)
+            return
+        }
+        if err != nil {
+            log.Printf("Failed to load category: %v", err)
+            http.Error(w, "Failed to load category: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        tags, attrs, err := itemTagsAndAttributes(db, category.ID, req.Tags, req.Attributes)
+        if err != nil {
+            log.Printf("Invalid tags or attributes: %v", err)
+            if isItemDetailError(err) {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+            } else {
+                http.Error(w, "Failed to load category attributes: "+err.Error(), http.StatusInternalServerError)
+            }
+            return
+        }
+
+        if req.MinNoticeDays < 0 || req.MaxAdvanceDays < 0 || req.CancellationWindowHours < 0 {
+            log.Println("Invalid request: negative booking window")
+            http.Error(w, "Minimum notice, maximum advance booking and cancellation window cannot be negative", http.StatusBadRequest)
+            return
+        }
+
+        if req.DepositCents < 0 || req.DailyFeeCents < 0 {
+            log.Println("Invalid request: negative deposit or fee")
+            http.Error(w, "Deposit and daily fee cannot be negative", http.StatusBadRequest)
+            return
+        }
+
+        if req.Quantity < 0 {
+            log.Println("Invalid request: negative quantity")
+            http.Error(w, "Quantity cannot be negative", http.StatusBadRequest)
+            return
+        }
+        if req.Quantity == 0 {
+            req.Quantity = 1
+        }
+
+        // A bundle is made of the seller's existing items
+        kind := models.ItemKindSingle
+        var components []models.Item
+        if len(req.ComponentIDs) > 0 {
+            loaded, err := models.LoadBundleComponents(db, userID, req.ComponentIDs)
+            if err != nil {
+                log.Printf("Invalid bundle components %v: %v", req.ComponentIDs, err)
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            components = loaded
+            kind = models.ItemKindBundle
+            req.Quantity = 1
+        }
+
         // Create the item
         item := models.Item{
             Title:       req.Title,
             Description: req.Description,
-            Category:    req.Category,
+            Category:    category.Name,
+            CategoryID:  &category.ID,
             ImageURL:    req.ImageURL,
             Status:      models.StatusAvailable,
             Location:    req.Location,
             Duration:    req.Duration,
+            Quantity:    req.Quantity,
+            Kind:        kind,
+            Components:  components,
+            MinNoticeDays:  req.MinNoticeDays,
+            MaxAdvanceDays: req.MaxAdvanceDays,
+            CancellationWindowHours: req.CancellationWindowHours,
+            DepositCents:  req.DepositCents,
+            DailyFeeCents: req.DailyFeeCents,
             SellerID:    userID,
         }
+
+        if err := resolveItemPosition(geocoder, &item, req); err != nil {
+            log.Printf("Invalid item position: %v", err)
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
         
         log.Printf("Creating item with SellerID: %d", userID)
 
-        if result := db.Create(&item); result.Error != nil {
-            log.Printf("Failed to create item: %v", result.Error)
-            http.Error(w, "Failed to create item: "+result.Error.Error(), http.StatusInternalServerError)
+        // Create the item along with its units, tags and attributes
+        err = db.Transaction(func(tx *gorm.DB) error {
+            if err := tx.Create(&item).Error; err != nil {
+                return err
+            }
+            if err := models.SetItemTags(tx, &item, tags); err != nil {
+                return err
+            }
+            if err := models.SetItemAttributes(tx, &item, attrs); err != nil {
+                return err
+            }
+            return models.SyncItemUnits(tx, &item)
+        })
+
+        if err != nil {
+            log.Printf("Failed to create item: %v", err)
+            http.Error(w, "Failed to create item: "+err.Error(), http.StatusInternalServerError)
             return
         }
         
@@ -163,7 +411,7 @@ func CreateItem(db *gorm.DB) http.HandlerFunc {
     }
 }
 
-func UpdateItem(db *gorm.DB) http.HandlerFunc {
+func UpdateItem(db *gorm.DB, geocoder geo.Geocoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the user ID from the context
 		userID, ok := middleware.GetUserIDFromContext(r)
@@ -200,16 +448,146 @@ func UpdateItem(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
+		if req.Duration <= 0 || req.MinNoticeDays < 0 || req.MaxAdvanceDays < 0 || req.CancellationWindowHours < 0 {
+			http.Error(w, "Duration must be positive and booking windows cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		if req.DepositCents < 0 || req.DailyFeeCents < 0 {
+			http.Error(w, "Deposit and daily fee cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		if req.Quantity < 0 {
+			http.Error(w, "Quantity cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		category, err := models.FindCategory(db, req.CategoryID, req.Category)
+		if errors.Is(err, models.ErrUnknownCategory) {
+			http.Error(w, "Unknown category", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load category: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Keep the current attribute values unless new ones are given,
+		// dropping those the schema of a changed category no longer has
+		values := req.Attributes
+		if values == nil {
+			var current []models.ItemAttribute
+			if err := db.Where("item_id = ?", item.ID).Find(&current).Error; err != nil {
+				http.Error(w, "Failed to load attributes: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			schema, err := models.AttributeSchema(db, category.ID)
+			if err != nil {
+				http.Error(w, "Failed to load category attributes: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			values = models.CarryOverAttributes(schema, current)
+		}
+		tags, attrs, err := itemTagsAndAttributes(db, category.ID, req.Tags, values)
+		if isItemDetailError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load category attributes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		// Update the item
 		item.Title = req.Title
 		item.Description = req.Description
-		item.Category = req.Category
+		item.Category = category.Name
+		item.CategoryID = &category.ID
 		item.ImageURL = req.ImageURL
 		item.Location = req.Location
 		item.Duration = req.Duration
+		item.MinNoticeDays = req.MinNoticeDays
+		item.MaxAdvanceDays = req.MaxAdvanceDays
+		item.CancellationWindowHours = req.CancellationWindowHours
+		item.DepositCents = req.DepositCents
+		item.DailyFeeCents = req.DailyFeeCents
+		if req.Quantity > 0 && !item.IsBundle() {
+			item.Quantity = req.Quantity
+		}
+		if err := resolveItemPosition(geocoder, &item, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var components []models.Item
+		if req.ComponentIDs != nil {
+			if !item.IsBundle() {
+				http.Error(w, "Only bundles have components", http.StatusBadRequest)
+				return
+			}
+			for _, componentID := range req.ComponentIDs {
+				if componentID == item.ID {
+					http.Error(w, models.ErrInvalidBundle.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			components, err = models.LoadBundleComponents(db, userID, req.ComponentIDs)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
-		if result := db.Save(&item); result.Error != nil {
-			http.Error(w, "Failed to update item: "+result.Error.Error(), http.StatusInternalServerError)
+		// Save the item and add or remove units to match its quantity
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Hold off approvals until the new quantity is checked
+			if err := models.LockRelatedItems(tx, &item); err != nil {
+				return err
+			}
+			if err := tx.Save(&item).Error; err != nil {
+				return err
+			}
+			if components != nil {
+				if err := tx.Model(&item).Association("Components").Replace(components); err != nil {
+					return err
+				}
+				// The new components take over the bundle's bookings
+				if err := models.LockRelatedItems(tx, &item); err != nil {
+					return err
+				}
+			}
+			if req.Tags != nil {
+				if err := models.SetItemTags(tx, &item, tags); err != nil {
+					return err
+				}
+			}
+			if err := models.SetItemAttributes(tx, &item, attrs); err != nil {
+				return err
+			}
+			if err := models.SyncItemUnits(tx, &item); err != nil {
+				return err
+			}
+			if item.IsBundle() && components == nil {
+				return nil
+			}
+			return models.CheckBookingsFit(tx, &item, time.Now())
+		})
+
+		if errors.Is(err, models.ErrUnitsInUse) {
+			http.Error(w, "Quantity is lower than the units on loan or in maintenance", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, models.ErrNotEnoughRoom) && item.IsBundle() {
+			http.Error(w, "The new components do not have enough units free for the bundle's upcoming loans", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, models.ErrNotEnoughRoom) {
+			http.Error(w, "Quantity is lower than the units booked for upcoming loans", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update item: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -249,9 +627,27 @@ func DeleteItem(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		// Delete the item
-		if result := db.Delete(&item); result.Error != nil {
-			http.Error(w, "Failed to delete item: "+result.Error.Error(), http.StatusInternalServerError)
+		// Items that are part of a bundle must be taken out of it first
+		bundles, err := models.BundlesContaining(db, []uint{item.ID})
+		if err != nil {
+			http.Error(w, "Failed to check bundles: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(bundles) > 0 {
+			http.Error(w, "This item is part of a bundle, remove it from the bundle first", http.StatusConflict)
+			return
+		}
+
+		// Delete the item along with its bundle links
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&item).Association("Components").Clear(); err != nil {
+				return err
+			}
+			return tx.Delete(&item).Error
+		})
+
+		if err != nil {
+			http.Error(w, "Failed to delete item: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -286,9 +682,28 @@ func GetMyItems(db *gorm.DB) http.HandlerFunc {
             return
         }
 
-        // Fetch the user's items
+        page, err := parsePageRequest(r, itemSortKeys, "-createdAt")
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+
+        query := db.Model(&models.Item{}).Where("seller_id = ?", userID).Session(&gorm.Session{})
+        total, err := page.countTotal(query)
+        if err != nil {
+            log.Printf("Error counting items: %v", err)
+            http.Error(w, "Failed to count items: "+err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        // Fetch a page of the user's items
+        paged, err := page.apply(query.Preload("Components").Preload("Tags").Preload("Attributes"), "items.id")
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
         var items []models.Item
-        if result := db.Where("seller_id = ?", userID).Find(&items); result.Error != nil {
+        if result := paged.Find(&items); result.Error != nil {
             log.Printf("Error fetching items: %v", result.Error)
             http.Error(w, "Failed to fetch items: "+result.Error.Error(), http.StatusInternalServerError)
             return
@@ -296,8 +711,16 @@ func GetMyItems(db *gorm.DB) http.HandlerFunc {
         
         log.Printf("Found %d items for user ID %d", len(items), userID)
 
-        // Return the items
+        response := PageResponse{Items: items, Total: total}
+        if page.hasMore(len(items)) {
+            items = items[:page.limit]
+            last := items[len(items)-1]
+            response.Items = items
+            response.NextCursor = page.nextCursor(itemSortValue(page, &last), last.ID)
+        }
+
+        // Return the page of items
         w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(items)
+        json.NewEncoder(w).Encode(response)
     }
 }
\ No newline at end of file
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+type LedgerResponse struct {
+	Entries  []models.LedgerEntry           `json:"entries"`
+	Balances map[models.LedgerAccount]int64 `json:"balances"`
+}
+
+// GetLedger returns the ledger of a loan, with per-account balances, to its
+// buyer, its seller or an admin.
+func GetLedger(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		if borrowRequest.BuyerID != userID && borrowRequest.Item.SellerID != userID && !isAdmin(db, userID) {
+			http.Error(w, "You can only view the ledger of your own loans", http.StatusForbidden)
+			return
+		}
+
+		var entries []models.LedgerEntry
+		if result := db.Where("borrow_request_id = ?", borrowRequest.ID).Order("id").Find(&entries); result.Error != nil {
+			http.Error(w, "Failed to fetch ledger: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		balances := map[models.LedgerAccount]int64{
+			models.AccountBuyer:  0,
+			models.AccountEscrow: 0,
+			models.AccountSeller: 0,
+		}
+		for _, e := range entries {
+			balances[e.Account] += e.AmountCents
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LedgerResponse{Entries: entries, Balances: balances})
+	}
+}
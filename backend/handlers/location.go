@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/geo"
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+// DefaultSearchRadiusKm is the radius of a near search that gives none, and
+// MaxSearchRadiusKm the largest radius allowed.
+var (
+	DefaultSearchRadiusKm = 10.0
+	MaxSearchRadiusKm     = 200.0
+)
+
+var errIncompleteCoordinates = errors.New("latitude and longitude must be given together")
+
+// ItemLocationResponse is the exact location of an item.
+type ItemLocationResponse struct {
+	Location  string   `json:"location"`
+	Address   string   `json:"address"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// parseNear reads the near=lat,lng and radius=km query parameters. It
+// returns a nil center when near is not given.
+func parseNear(r *http.Request) (*geo.Point, float64, error) {
+	near := r.URL.Query().Get("near")
+	radiusParam := r.URL.Query().Get("radius")
+	if near == "" {
+		if radiusParam != "" {
+			return nil, 0, errors.New("radius requires near")
+		}
+		return nil, 0, nil
+	}
+
+	parts := strings.Split(near, ",")
+	if len(parts) != 2 {
+		return nil, 0, errors.New("near must be latitude,longitude")
+	}
+	lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lng, lngErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if latErr != nil || lngErr != nil {
+		return nil, 0, errors.New("near must be latitude,longitude")
+	}
+	center := geo.Point{Lat: lat, Lng: lng}
+	if !center.Valid() {
+		return nil, 0, geo.ErrInvalidPoint
+	}
+
+	radius := DefaultSearchRadiusKm
+	if radiusParam != "" {
+		v, err := strconv.ParseFloat(radiusParam, 64)
+		if err != nil || v <= 0 || v > MaxSearchRadiusKm {
+			return nil, 0, fmt.Errorf("radius must be a number of km above 0 and at most %g", MaxSearchRadiusKm)
+		}
+		radius = v
+	}
+	return &center, radius, nil
+}
+
+// resolveItemPosition sets the item's address and position from the
+// request. Without coordinates the address is geocoded, unless it has not
+// changed and the item already has a position; an omitted address keeps the
+// item's current one. A geocoder that fails or cannot find the address only
+// leaves the item without a position.
+func resolveItemPosition(geocoder geo.Geocoder, item *models.Item, req ItemRequest) error {
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return errIncompleteCoordinates
+	}
+	address := item.Address
+	if req.Address != nil {
+		address = *req.Address
+	}
+	if req.Latitude != nil {
+		p := geo.Point{Lat: *req.Latitude, Lng: *req.Longitude}
+		if !p.Valid() {
+			return geo.ErrInvalidPoint
+		}
+		item.Address = address
+		item.SetPosition(&p)
+		return nil
+	}
+
+	if req.Address == nil || (address == item.Address && item.Latitude != nil) {
+		return nil
+	}
+	item.Address = address
+	item.SetPosition(nil)
+	if address == "" || geocoder == nil {
+		return nil
+	}
+
+	p, err := geocoder.Geocode(address)
+	if err != nil {
+		log.Printf("Geocoding failed, saving item without a position: %v", err)
+		return nil
+	}
+	item.SetPosition(&p)
+	return nil
+}
+
+// GetItemLocation reveals an item's exact address to its seller and to
+// buyers holding an approved loan of it.
+func GetItemLocation(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the item ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		// Find the item
+		var item models.Item
+		if result := db.First(&item, id); result.Error != nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+
+		// Buyers only see the address once a loan has been approved
+		if item.SellerID != userID {
+			var loans int64
+			if err := db.Model(&models.BorrowRequest{}).
+				Where("item_id = ? AND buyer_id = ? AND status IN ?", item.ID, userID, models.BookedStatuses).
+				Count(&loans).Error; err != nil {
+				http.Error(w, "Failed to check loans: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if loans == 0 {
+				http.Error(w, "The address is shown once your request is approved", http.StatusForbidden)
+				return
+			}
+		}
+
+		resp := ItemLocationResponse{
+			Location:  item.Location,
+			Address:   item.Address,
+			Latitude:  item.Latitude,
+			Longitude: item.Longitude,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+// GetMyOverdueRequests lists the buyer's loans that are past their end date.
+func GetMyOverdueRequests(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		page, err := parsePageRequest(r, borrowRequestSortKeys, "endDate")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.BorrowRequest{}).
+			Where("buyer_id = ? AND status = ?", userID, models.StatusOverdue).
+			Session(&gorm.Session{})
+		total, err := page.countTotal(query)
+		if err != nil {
+			http.Error(w, "Failed to count overdue requests: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Find a page of the user's overdue loans
+		paged, err := page.apply(query, "borrow_requests.id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var borrowRequests []models.BorrowRequest
+		if result := paged.Preload("Item").Preload("Item.Seller").Find(&borrowRequests); result.Error != nil {
+			http.Error(w, "Failed to fetch overdue requests: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := PageResponse{Items: borrowRequests, Total: total}
+		if page.hasMore(len(borrowRequests)) {
+			borrowRequests = borrowRequests[:page.limit]
+			last := borrowRequests[len(borrowRequests)-1]
+			response.Items = borrowRequests
+			response.NextCursor = page.nextCursor(borrowRequestSortValue(page, &last), last.ID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetMyOverdueItems lists overdue loans of the seller's items.
+func GetMyOverdueItems(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		page, err := parsePageRequest(r, borrowRequestSortKeys, "endDate")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.BorrowRequest{}).
+			Joins("JOIN items ON borrow_requests.item_id = items.id").
+			Where("items.seller_id = ? AND borrow_requests.status = ?", userID, models.StatusOverdue).
+			Session(&gorm.Session{})
+		total, err := page.countTotal(query)
+		if err != nil {
+			log.Printf("Failed to count overdue requests: %v", err)
+			http.Error(w, "Failed to count overdue requests: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Find a page of overdue loans of the user's items
+		paged, err := page.apply(query, "borrow_requests.id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var borrowRequests []models.BorrowRequest
+		if result := paged.Preload("Item").Preload("Buyer").Find(&borrowRequests); result.Error != nil {
+			log.Printf("Failed to fetch overdue requests: %v", result.Error)
+			http.Error(w, "Failed to fetch overdue requests: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Found %d overdue loans for user ID %d", len(borrowRequests), userID)
+
+		response := PageResponse{Items: borrowRequests, Total: total}
+		if page.hasMore(len(borrowRequests)) {
+			borrowRequests = borrowRequests[:page.limit]
+			last := borrowRequests[len(borrowRequests)-1]
+			response.Items = borrowRequests
+			response.NextCursor = page.nextCursor(borrowRequestSortValue(page, &last), last.ID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
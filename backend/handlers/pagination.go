@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// PageResponse is the envelope of every list endpoint. NextCursor is empty
+// on the last page. Total is only included when the caller asks for it with
+// total=true, since it costs an extra query.
+type PageResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+	Total      *int64      `json:"total,omitempty"`
+}
+
+type sortKind int
+
+const (
+	sortTime sortKind = iota
+	sortString
+	sortFloat
+	// sortOffset keys, such as search relevance, have no column to seek
+	// on and page by offset instead.
+	sortOffset
+)
+
+// sortKey is a column a list can be sorted on.
+type sortKey struct {
+	column string
+	kind   sortKind
+}
+
+// pageCursor marks where the previous page ended: the sort value and ID of
+// its last row, or for offset keys the number of rows already returned.
+type pageCursor struct {
+	Sort   string `json:"s"`
+	Value  string `json:"v,omitempty"`
+	ID     uint   `json:"id,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+// pageRequest holds the parsed limit, cursor, sort and total parameters of a
+// list request.
+type pageRequest struct {
+	limit     int
+	sort      string
+	key       sortKey
+	desc      bool
+	after     *pageCursor
+	withTotal bool
+}
+
+// parsePageRequest reads limit, cursor, sort and total from the query string.
+// sort names one of keys, optionally prefixed with "-" for descending order;
+// it defaults to defaultSort.
+func parsePageRequest(r *http.Request, keys map[string]sortKey, defaultSort string) (pageRequest, error) {
+	params := r.URL.Query()
+	p := pageRequest{limit: defaultPageLimit, withTotal: params.Get("total") == "true"}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		p.limit = limit
+	}
+
+	sortParam := params.Get("sort")
+	if sortParam == "" {
+		sortParam = defaultSort
+	}
+	p.desc = strings.HasPrefix(sortParam, "-")
+	p.sort = strings.TrimPrefix(sortParam, "-")
+	key, ok := keys[p.sort]
+	if !ok {
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return p, fmt.Errorf("sort must be one of %s", strings.Join(names, ", "))
+	}
+	p.key = key
+
+	if v := params.Get("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return p, errors.New("invalid cursor")
+		}
+		var c pageCursor
+		if err := json.Unmarshal(raw, &c); err != nil || c.Sort != sortParam || c.Offset < 0 {
+			return p, errors.New("invalid cursor")
+		}
+		p.after = &c
+	}
+	return p, nil
+}
+
+// cursorValue converts the value stored in the cursor back to the column's
+// type.
+func (p pageRequest) cursorValue() (interface{}, error) {
+	switch p.key.kind {
+	case sortTime:
+		return time.Parse(time.RFC3339Nano, p.after.Value)
+	case sortFloat:
+		return strconv.ParseFloat(p.after.Value, 64)
+	}
+	return p.after.Value, nil
+}
+
+// apply orders query by the sort key with idColumn as a tie-breaker, skips
+// the rows up to the cursor and fetches one row more than the limit so the
+// caller can tell whether another page follows. Offset keys are paged by
+// the caller.
+func (p pageRequest) apply(query *gorm.DB, idColumn string) (*gorm.DB, error) {
+	dir, op := "ASC", ">"
+	if p.desc {
+		dir, op = "DESC", "<"
+	}
+
+	if p.after != nil {
+		value, err := p.cursorValue()
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		query = query.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", p.key.column, idColumn, op), value, p.after.ID)
+	}
+	return query.
+		Order(fmt.Sprintf("%s %s, %s %s", p.key.column, dir, idColumn, dir)).
+		Limit(p.limit + 1), nil
+}
+
+// hasMore reports whether n rows fetched by apply include a row beyond the
+// page, meaning another page follows.
+func (p pageRequest) hasMore(n int) bool {
+	return n > p.limit
+}
+
+// nextCursor returns the cursor for the page after one whose last row has
+// the given sort value and ID.
+func (p pageRequest) nextCursor(value interface{}, id uint) string {
+	c := pageCursor{Sort: p.sortParam()}
+	if p.key.kind == sortOffset {
+		c.Offset = p.limit
+		if p.after != nil {
+			c.Offset += p.after.Offset
+		}
+	} else {
+		switch v := value.(type) {
+		case time.Time:
+			c.Value = v.Format(time.RFC3339Nano)
+		case float64:
+			c.Value = strconv.FormatFloat(v, 'g', -1, 64)
+		case string:
+			c.Value = v
+		}
+		c.ID = id
+	}
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func (p pageRequest) sortParam() string {
+	if p.desc {
+		return "-" + p.sort
+	}
+	return p.sort
+}
+
+// itemSortKeys are the sort options of item lists.
+var itemSortKeys = map[string]sortKey{
+	"createdAt": {column: "items.created_at", kind: sortTime},
+	"title":     {column: "items.title", kind: sortString},
+	"rating":    {column: "items.rating_average", kind: sortFloat},
+}
+
+// itemListSortKeys returns the sort options of an item list, adding
+// relevance for text searches and distance for radius searches.
+func itemListSortKeys(search, near bool) map[string]sortKey {
+	keys := make(map[string]sortKey, len(itemSortKeys)+2)
+	for name, key := range itemSortKeys {
+		keys[name] = key
+	}
+	if search {
+		keys["relevance"] = sortKey{kind: sortOffset}
+	}
+	if near {
+		keys["distance"] = sortKey{kind: sortOffset}
+	}
+	return keys
+}
+
+// borrowRequestSortKeys are the sort options of borrow request lists.
+var borrowRequestSortKeys = map[string]sortKey{
+	"createdAt": {column: "borrow_requests.created_at", kind: sortTime},
+	"startDate": {column: "borrow_requests.start_date", kind: sortTime},
+	"endDate":   {column: "borrow_requests.end_date", kind: sortTime},
+}
+
+// reviewSortKeys are the sort options of review lists.
+var reviewSortKeys = map[string]sortKey{
+	"publishedAt": {column: "reviews.published_at", kind: sortTime},
+}
+
+// disputeSortKeys are the sort options of dispute lists.
+var disputeSortKeys = map[string]sortKey{
+	"createdAt": {column: "disputes.created_at", kind: sortTime},
+}
+
+// auditSortKeys are the sort options of audit logs.
+var auditSortKeys = map[string]sortKey{
+	"createdAt": {column: "audit_entries.created_at", kind: sortTime},
+}
+
+// waitlistSortKeys are the sort options of waitlists.
+var waitlistSortKeys = map[string]sortKey{
+	"createdAt": {column: "waitlist_entries.created_at", kind: sortTime},
+}
+
+func itemSortValue(p pageRequest, item *models.Item) interface{} {
+	switch p.sort {
+	case "title":
+		return item.Title
+	case "rating":
+		return item.RatingAverage
+	}
+	return item.CreatedAt
+}
+
+func borrowRequestSortValue(p pageRequest, br *models.BorrowRequest) interface{} {
+	switch p.sort {
+	case "startDate":
+		return br.StartDate
+	case "endDate":
+		return br.EndDate
+	}
+	return br.CreatedAt
+}
+
+// countTotal counts the rows matching query if the caller asked for a total.
+func (p pageRequest) countTotal(query *gorm.DB) (*int64, error) {
+	if !p.withTotal {
+		return nil, nil
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	return &total, nil
+}
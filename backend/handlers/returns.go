@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+	"resource-sharing/payments"
+)
+
+// MarkBorrowRequestReturned lets the buyer report that an approved item has
+// been handed back. The seller still has to confirm the return.
+func MarkBorrowRequestReturned(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			log.Printf("Invalid borrow request ID: %v", err)
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Marking borrow request ID: %d as returned for user ID: %d", id, userID)
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.First(&borrowRequest, id); result.Error != nil {
+			log.Printf("Borrow request not found: %v", result.Error)
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the user is the buyer
+		if borrowRequest.BuyerID != userID {
+			log.Printf("User %d is not the buyer of request %d", userID, id)
+			http.Error(w, "You can only return items you have borrowed", http.StatusForbidden)
+			return
+		}
+
+		// Check that the seller will be able to close the loan
+		if err := models.CanTransition(borrowRequest.Status, models.StatusReturned, models.ActorSeller); err != nil {
+			writeTransitionError(w, id, err)
+			return
+		}
+
+		if borrowRequest.ReturnRequestedAt != nil {
+			http.Error(w, "Return has already been reported", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		borrowRequest.ReturnRequestedAt = &now
+
+		if result := db.Save(&borrowRequest); result.Error != nil {
+			log.Printf("Failed to mark borrow request as returned: %v", result.Error)
+			http.Error(w, "Failed to mark borrow request as returned: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Borrow request %d marked as returned by buyer", id)
+
+		// Return the updated borrow request
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(borrowRequest)
+	}
+}
+
+// ConfirmBorrowRequestReturn lets the seller confirm that a borrowed item is
+// back by entering the buyer's return code. The request moves to returned,
+// the item becomes available again and the deposit is refunded unless a
+// dispute is open. A return condition report, if filed, must be acknowledged
+// by both parties.
+func ConfirmBorrowRequestReturn(db *gorm.DB, processor payments.Processor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			log.Printf("Invalid borrow request ID: %v", err)
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Confirming return of borrow request ID: %d for user ID: %d", id, userID)
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			log.Printf("Borrow request not found: %v", result.Error)
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the user is the seller of the item
+		if borrowRequest.Item.SellerID != userID {
+			log.Printf("User %d is not the seller of item %d", userID, borrowRequest.Item.ID)
+			http.Error(w, "You can only confirm returns for your own items", http.StatusForbidden)
+			return
+		}
+
+		// Parse the request body
+		var req HandoffCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Move the request to returned
+		if err := borrowRequest.TransitionTo(models.StatusReturned, models.ActorSeller); err != nil {
+			writeTransitionError(w, id, err)
+			return
+		}
+
+		// Both parties must agree on the condition the item changed hands in
+		if err := models.CheckReportAcknowledged(db, borrowRequest.ID, models.HandoffReturn); err != nil {
+			writeReportError(w, id, err)
+			return
+		}
+
+		if err := models.UseHandoffAttempt(db, borrowRequest.ID); err != nil {
+			writeHandoffMismatch(w, id, models.HandoffReturn, err)
+			return
+		}
+		if !models.MatchHandoffCode(models.HandoffReturn, borrowRequest.ID, borrowRequest.ReturnCode, req.Code) {
+			writeHandoffMismatch(w, id, models.HandoffReturn, nil)
+			return
+		}
+
+		// The seller may confirm without a prior buyer report, e.g. when the
+		// buyer dropped the item off without using the app.
+		now := time.Now()
+		if borrowRequest.ReturnRequestedAt == nil {
+			borrowRequest.ReturnRequestedAt = &now
+		}
+		borrowRequest.ReturnedAt = &now
+		borrowRequest.ReturnCode = ""
+		borrowRequest.HandoffAttempts = 0
+		// An item under dispute stays frozen until the dispute is resolved
+		frozen := borrowRequest.Item.Status == models.StatusFrozen
+		if !frozen {
+			borrowRequest.Item.Status = models.StatusAvailable
+		}
+
+		// Save the changes in a transaction
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Hold the item and make sure a concurrent confirmation has not
+			// closed the loan already, so the deposit is settled once
+			if err := models.LockRelatedItems(tx, &borrowRequest.Item); err != nil {
+				return err
+			}
+			if err := models.LockTransition(tx, borrowRequest.ID, models.StatusReturned, models.ActorSeller); err != nil {
+				return err
+			}
+			if err := tx.Model(&borrowRequest).
+				Select("status", "return_requested_at", "returned_at", "return_code", "handoff_attempts").
+				Updates(&borrowRequest).Error; err != nil {
+				return err
+			}
+			if err := models.ReleaseUnits(tx, &borrowRequest); err != nil {
+				return err
+			}
+			if err := models.RefreshComponentStatuses(tx, &borrowRequest.Item); err != nil {
+				return err
+			}
+			if !frozen {
+				if err := tx.Model(&borrowRequest.Item).Update("status", borrowRequest.Item.Status).Error; err != nil {
+					return err
+				}
+				if _, err := models.OfferNextWaitlistEntry(tx, borrowRequest.ItemID, now, WaitlistClaimWindow); err != nil {
+					return err
+				}
+			}
+
+			// An open dispute on this loan decides what happens to the
+			// deposit when it is resolved
+			var disputed int64
+			if err := tx.Model(&models.Dispute{}).
+				Where("borrow_request_id = ? AND status = ?", borrowRequest.ID, models.StatusOpen).
+				Count(&disputed).Error; err != nil {
+				return err
+			}
+			if disputed > 0 {
+				return nil
+			}
+			damage, err := models.ResolvedDisputeCharges(tx, &borrowRequest)
+			if err != nil {
+				return err
+			}
+			return payments.SettleDeposit(tx, &borrowRequest, damage)
+		})
+
+		if errors.Is(err, models.ErrInvalidTransition) {
+			writeTransitionError(w, id, err)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to confirm return: %v", err)
+			http.Error(w, "Failed to confirm return: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := payments.Flush(db, processor, borrowRequest.ID); err != nil {
+			log.Printf("Payments for borrow request %d left pending: %v", id, err)
+		}
+
+		log.Printf("Successfully confirmed return of borrow request %d", id)
+
+		// Return the updated borrow request
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(borrowRequest)
+	}
+}
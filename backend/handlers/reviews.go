@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+// ReviewWindow is how long after a return both parties may review the loan.
+// Hidden reviews are published when it closes. main overrides it from the
+// environment.
+var ReviewWindow = 14 * 24 * time.Hour
+
+type ReviewRequest struct {
+	Score int    `json:"score"`
+	Text  string `json:"text"`
+}
+
+// CreateReview lets the buyer review the item and seller, or the seller review
+// the buyer, once a loan is returned. The review stays hidden until the other
+// party has reviewed too or the window closes.
+func CreateReview(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the borrow request ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid borrow request ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Find the borrow request
+		var borrowRequest models.BorrowRequest
+		if result := db.Preload("Item").First(&borrowRequest, id); result.Error != nil {
+			http.Error(w, "Borrow request not found", http.StatusNotFound)
+			return
+		}
+
+		review := models.Review{BorrowRequestID: borrowRequest.ID, ReviewerID: userID}
+		switch userID {
+		case borrowRequest.BuyerID:
+			review.Direction = models.ReviewOfSeller
+			review.RevieweeID = borrowRequest.Item.SellerID
+			review.ItemID = &borrowRequest.ItemID
+		case borrowRequest.Item.SellerID:
+			review.Direction = models.ReviewOfBuyer
+			review.RevieweeID = borrowRequest.BuyerID
+		default:
+			http.Error(w, "You can only review your own loans", http.StatusForbidden)
+			return
+		}
+
+		if borrowRequest.Status != models.StatusReturned || borrowRequest.ReturnedAt == nil {
+			http.Error(w, "Only returned loans can be reviewed", http.StatusConflict)
+			return
+		}
+
+		now := time.Now()
+		if now.After(borrowRequest.ReturnedAt.Add(ReviewWindow)) {
+			http.Error(w, "The review window for this loan has closed", http.StatusConflict)
+			return
+		}
+
+		// Parse the request body
+		var req ReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Score < 1 || req.Score > 5 {
+			http.Error(w, "Score must be between 1 and 5", http.StatusBadRequest)
+			return
+		}
+		review.Score = req.Score
+		review.Text = req.Text
+
+		var existing int64
+		if result := db.Model(&models.Review{}).
+			Where("borrow_request_id = ? AND reviewer_id = ?", borrowRequest.ID, userID).
+			Count(&existing); result.Error != nil {
+			http.Error(w, "Failed to check reviews: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing > 0 {
+			http.Error(w, "You have already reviewed this loan", http.StatusConflict)
+			return
+		}
+
+		// Save the review, publishing both once each side has submitted
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&review).Error; err != nil {
+				return err
+			}
+			var submitted int64
+			if err := tx.Model(&models.Review{}).Where("borrow_request_id = ?", borrowRequest.ID).Count(&submitted).Error; err != nil {
+				return err
+			}
+			if submitted < 2 {
+				return nil
+			}
+			review.PublishedAt = &now
+			return models.PublishReviews(tx, borrowRequest.ID, now)
+		})
+
+		if err != nil {
+			log.Printf("Failed to create review: %v", err)
+			http.Error(w, "Failed to create review: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %d reviewed borrow request %d", userID, id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	}
+}
+
+// GetUserReviews returns the published reviews about a user.
+func GetUserReviews(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		page, err := parsePageRequest(r, reviewSortKeys, "-publishedAt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.Review{}).
+			Where("reviewee_id = ? AND published_at IS NOT NULL", id).
+			Session(&gorm.Session{})
+		total, err := page.countTotal(query)
+		if err != nil {
+			http.Error(w, "Failed to count reviews: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		paged, err := page.apply(query, "reviews.id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var reviews []models.Review
+		if result := paged.Preload("Reviewer").Find(&reviews); result.Error != nil {
+			http.Error(w, "Failed to fetch reviews: "+result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := PageResponse{Items: reviews, Total: total}
+		if page.hasMore(len(reviews)) {
+			reviews = reviews[:page.limit]
+			last := reviews[len(reviews)-1]
+			response.Items = reviews
+			response.NextCursor = page.nextCursor(*last.PublishedAt, last.ID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
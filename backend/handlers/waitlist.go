@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"resource-sharing/middleware"
+	"resource-sharing/models"
+)
+
+// WaitlistClaimWindow is how long a waitlisted buyer has to request an item
+// once it is offered to them. main overrides it from the environment.
+var WaitlistClaimWindow = 24 * time.Hour
+
+// activeWaitlistStatuses are the statuses of entries still in the queue.
+var activeWaitlistStatuses = []models.Status{models.StatusWaiting, models.StatusOffered}
+
+// WaitlistRequest gives the dates and number of units the buyer wants an
+// item for. All fields are optional; without dates the buyer waits for the
+// item's full loan length starting now.
+type WaitlistRequest struct {
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	Quantity  int       `json:"quantity"`
+}
+
+// joinWaitlist adds the buyer to the item's waitlist, or returns their
+// existing entry if they are already queued.
+func joinWaitlist(db *gorm.DB, itemID, buyerID uint) (models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	result := db.Where("item_id = ? AND buyer_id = ? AND status IN ?", itemID, buyerID, activeWaitlistStatuses).
+		Limit(1).Find(&entry)
+	if result.Error != nil {
+		return entry, result.Error
+	}
+	if result.RowsAffected == 0 {
+		entry = models.WaitlistEntry{
+			ItemID:  itemID,
+			BuyerID: buyerID,
+			Status:  models.StatusWaiting,
+		}
+		if err := db.Create(&entry).Error; err != nil {
+			return entry, err
+		}
+	}
+	if entry.Status == models.StatusWaiting {
+		position, err := models.WaitlistPosition(db, &entry)
+		if err != nil {
+			return entry, err
+		}
+		entry.Position = position
+	}
+	return entry, nil
+}
+
+// JoinWaitlist queues the buyer for an item that has no units free for the
+// dates they want.
+func JoinWaitlist(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			log.Println("User ID not found in context")
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Check if the user is a buyer
+		var user models.User
+		if result := db.First(&user, userID); result.Error != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if user.Role != models.RoleBuyer {
+			http.Error(w, "Only buyers can join waitlists", http.StatusForbidden)
+			return
+		}
+
+		// Get the item ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		// Find the item
+		var item models.Item
+		if result := db.First(&item, id); result.Error != nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+
+		// The body is optional, so an empty one is fine
+		var req WaitlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "Failed to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.StartDate.IsZero() != req.EndDate.IsZero() {
+			http.Error(w, "Give both a start and an end date, or neither", http.StatusBadRequest)
+			return
+		}
+		if req.StartDate.IsZero() {
+			req.StartDate = time.Now()
+			req.EndDate = req.StartDate.AddDate(0, 0, item.Duration)
+		}
+		if !req.EndDate.After(req.StartDate) {
+			http.Error(w, "End date must be after start date", http.StatusBadRequest)
+			return
+		}
+		if req.Quantity == 0 {
+			req.Quantity = 1
+		}
+		if req.Quantity < 0 {
+			http.Error(w, "Quantity must be positive", http.StatusBadRequest)
+			return
+		}
+
+		// Units are only taken at pickup, so the item's status says nothing
+		// about whether the dates are booked
+		err = models.CheckCapacity(db, &item, req.StartDate, req.EndDate, req.Quantity, 0)
+		if err == nil {
+			http.Error(w, "Item is available for these dates, request it directly instead", http.StatusConflict)
+			return
+		}
+		if !errors.Is(err, models.ErrNotEnoughRoom) {
+			log.Printf("Failed to check availability: %v", err)
+			http.Error(w, "Failed to check availability: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		blocked, err := models.IsBuyerBlocked(db, item.SellerID, userID)
+		if err != nil {
+			http.Error(w, "Failed to check blocklist: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			writeCodedError(w, ErrorCodeBuyerBlocked, models.ErrBuyerBlocked.Error(), http.StatusForbidden)
+			return
+		}
+
+		entry, err := joinWaitlist(db, item.ID, userID)
+		if err != nil {
+			log.Printf("Failed to join waitlist: %v", err)
+			http.Error(w, "Failed to join waitlist: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %d joined waitlist for item %d (entry %d)", userID, item.ID, entry.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+// LeaveWaitlist removes the buyer from an item's waitlist. If they held the
+// current offer it passes to the next buyer.
+func LeaveWaitlist(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the item ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		var entry models.WaitlistEntry
+		if result := db.Where("item_id = ? AND buyer_id = ? AND status IN ?", id, userID, activeWaitlistStatuses).
+			First(&entry); result.Error != nil {
+			http.Error(w, "You are not on the waitlist for this item", http.StatusNotFound)
+			return
+		}
+
+		wasOffered := entry.Status == models.StatusOffered
+		entry.Status = models.StatusCancelled
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&entry).Error; err != nil {
+				return err
+			}
+			if wasOffered {
+				_, err := models.OfferNextWaitlistEntry(tx, entry.ItemID, time.Now(), WaitlistClaimWindow)
+				return err
+			}
+			return nil
+		})
+
+		if err != nil {
+			log.Printf("Failed to leave waitlist: %v", err)
+			http.Error(w, "Failed to leave waitlist: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetItemWaitlist returns the queue for one of the seller's items.
+func GetItemWaitlist(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		// Get the item ID from the URL
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		// Find the item
+		var item models.Item
+		if result := db.First(&item, id); result.Error != nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+
+		if item.SellerID != userID {
+			http.Error(w, "You can only view waitlists for your own items", http.StatusForbidden)
+			return
+		}
+
+		page, err := parsePageRequest(r, waitlistSortKeys, "createdAt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.WaitlistEntry{}).
+			Where("item_id = ? AND status IN ?", item.ID, activeWaitlistStatuses).
+			Session(&gorm.Session{})
+		response, ok := fetchWaitlistPage(w, db, page, query, "Buyer")
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetMyWaitlist returns the buyer's waitlist entries and offers.
+func GetMyWaitlist(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the context
+		userID, ok := middleware.GetUserIDFromContext(r)
+		if !ok {
+			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		page, err := parsePageRequest(r, waitlistSortKeys, "createdAt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Model(&models.WaitlistEntry{}).
+			Where("buyer_id = ? AND status IN ?", userID, activeWaitlistStatuses).
+			Session(&gorm.Session{})
+		response, ok := fetchWaitlistPage(w, db, page, query, "Item")
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// fetchWaitlistPage loads a page of the waitlist entries matching query with
+// the given association, and sets the queue position of each waiting entry.
+// It writes the error response and returns false on failure.
+func fetchWaitlistPage(w http.ResponseWriter, db *gorm.DB, page pageRequest, query *gorm.DB, preload string) (PageResponse, bool) {
+	var response PageResponse
+	total, err := page.countTotal(query)
+	if err != nil {
+		http.Error(w, "Failed to count waitlist: "+err.Error(), http.StatusInternalServerError)
+		return response, false
+	}
+	response.Total = total
+
+	paged, err := page.apply(query, "waitlist_entries.id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return response, false
+	}
+	var entries []models.WaitlistEntry
+	if result := paged.Preload(preload).Find(&entries); result.Error != nil {
+		http.Error(w, "Failed to fetch waitlist: "+result.Error.Error(), http.StatusInternalServerError)
+		return response, false
+	}
+	if page.hasMore(len(entries)) {
+		entries = entries[:page.limit]
+		last := entries[len(entries)-1]
+		response.NextCursor = page.nextCursor(last.CreatedAt, last.ID)
+	}
+
+	// Positions count the whole queue, not just this page
+	for i := range entries {
+		if entries[i].Status != models.StatusWaiting {
+			continue
+		}
+		position, err := models.WaitlistPosition(db, &entries[i])
+		if err != nil {
+			http.Error(w, "Failed to fetch waitlist: "+err.Error(), http.StatusInternalServerError)
+			return response, false
+		}
+		entries[i].Position = position
+	}
+	response.Items = entries
+	return response, true
+}
@@ -0,0 +1,16 @@
+package jobs
+
+import "time"
+
+// Clock supplies the current time to jobs so they can be driven by a fake
+// clock in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock reads the system clock.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
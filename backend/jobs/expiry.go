@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+)
+
+// ExpirePendingRequests returns a job that expires pending requests whose
+// start date has passed, or which have waited longer than sla for a seller
+// response. A zero sla disables the response deadline.
+func ExpirePendingRequests(db *gorm.DB, sla time.Duration) Job {
+	return func(ctx context.Context, now time.Time) error {
+		query := db.WithContext(ctx).Where("status = ?", models.StatusPending)
+		if sla > 0 {
+			query = query.Where("start_date <= ? OR created_at <= ?", now, now.Add(-sla))
+		} else {
+			query = query.Where("start_date <= ?", now)
+		}
+
+		var stale []models.BorrowRequest
+		if err := query.Find(&stale).Error; err != nil {
+			return err
+		}
+
+		for i := range stale {
+			if err := stale[i].TransitionTo(models.StatusExpired, models.ActorSystem); err != nil {
+				return err
+			}
+			// Only expire the request if the seller hasn't acted on it since
+			// it was loaded
+			result := db.WithContext(ctx).Model(&models.BorrowRequest{}).
+				Where("id = ? AND status = ?", stale[i].ID, models.StatusPending).
+				Update("status", stale[i].Status)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			log.Printf("Expired pending borrow request %d", stale[i].ID)
+		}
+		return nil
+	}
+}
+
+// ExpireMissedPickups returns a job that expires approved loans whose end
+// date passed without the item ever being picked up, offering the item to the
+// next waitlisted buyer, who gets window to claim it.
+func ExpireMissedPickups(db *gorm.DB, window time.Duration) Job {
+	return func(ctx context.Context, now time.Time) error {
+		var missed []models.BorrowRequest
+		if err := db.WithContext(ctx).
+			Where("status = ? AND end_date <= ?", models.StatusApproved, now).
+			Find(&missed).Error; err != nil {
+			return err
+		}
+
+		for i := range missed {
+			if err := missed[i].TransitionTo(models.StatusExpired, models.ActorSystem); err != nil {
+				return err
+			}
+			var expired bool
+			err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				result := tx.Model(&models.BorrowRequest{}).
+					Where("id = ? AND status = ?", missed[i].ID, models.StatusApproved).
+					Updates(map[string]interface{}{"status": missed[i].Status, "pickup_code": ""})
+				if result.Error != nil || result.RowsAffected == 0 {
+					return result.Error
+				}
+				expired = true
+				_, err := models.OfferNextWaitlistEntry(tx, missed[i].ItemID, now, window)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if expired {
+				log.Printf("Expired approved borrow request %d that was never picked up", missed[i].ID)
+			}
+		}
+		return nil
+	}
+}
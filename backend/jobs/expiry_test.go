@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"resource-sharing/models"
+	"resource-sharing/testdb"
+)
+
+func TestExpirePendingRequests(t *testing.T) {
+	db := testdb.Open(t)
+	clock := newFakeClock()
+	_, buyer, item := seedItem(t, db)
+
+	now := clock.Now()
+	started := seedLoan(t, db, item, buyer.ID, models.StatusPending, now.Add(-time.Hour), now.Add(48*time.Hour))
+	future := seedLoan(t, db, item, buyer.ID, models.StatusPending, now.Add(24*time.Hour), now.Add(72*time.Hour))
+	approved := seedLoan(t, db, item, buyer.ID, models.StatusApproved, now.Add(-time.Hour), now.Add(48*time.Hour))
+
+	job := ExpirePendingRequests(db, 72*time.Hour)
+	run(t, job, clock)
+
+	if got := statusOf(t, db, started.ID); got != models.StatusExpired {
+		t.Errorf("request past its start date is %s, want expired", got)
+	}
+	if got := statusOf(t, db, future.ID); got != models.StatusPending {
+		t.Errorf("request within the SLA is %s, want pending", got)
+	}
+	if got := statusOf(t, db, approved.ID); got != models.StatusApproved {
+		t.Errorf("approved request is %s, want approved", got)
+	}
+
+	// Once the SLA passes the seller has waited too long
+	clock.Advance(73 * time.Hour)
+	run(t, job, clock)
+	if got := statusOf(t, db, future.ID); got != models.StatusExpired {
+		t.Errorf("request past the SLA is %s, want expired", got)
+	}
+}
+
+func TestExpireMissedPickups(t *testing.T) {
+	db := testdb.Open(t)
+	clock := newFakeClock()
+	_, buyer, item := seedItem(t, db)
+
+	now := clock.Now()
+	missed := seedLoan(t, db, item, buyer.ID, models.StatusApproved, now.Add(-72*time.Hour), now.Add(-time.Hour))
+	upcoming := seedLoan(t, db, item, buyer.ID, models.StatusApproved, now.Add(time.Hour), now.Add(24*time.Hour))
+	active := seedLoan(t, db, item, buyer.ID, models.StatusActive, now.Add(-72*time.Hour), now.Add(-time.Hour))
+	waiting := models.WaitlistEntry{ItemID: item.ID, BuyerID: buyer.ID, Status: models.StatusWaiting}
+	testdb.Create(t, db, &waiting)
+
+	run(t, ExpireMissedPickups(db, time.Hour), clock)
+
+	if got := statusOf(t, db, missed.ID); got != models.StatusExpired {
+		t.Errorf("loan never picked up is %s, want expired", got)
+	}
+	if got := statusOf(t, db, upcoming.ID); got != models.StatusApproved {
+		t.Errorf("upcoming loan is %s, want approved", got)
+	}
+	if got := statusOf(t, db, active.ID); got != models.StatusActive {
+		t.Errorf("picked up loan is %s, want active", got)
+	}
+
+	// The freed item goes to the next buyer in line
+	db.First(&waiting, waiting.ID)
+	if waiting.Status != models.StatusOffered || !waiting.OfferExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("waitlist entry is %s until %v, want offered for an hour", waiting.Status, waiting.OfferExpiresAt)
+	}
+}
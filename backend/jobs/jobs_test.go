@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+	"resource-sharing/testdb"
+)
+
+// fakeClock is a Clock that only moves when the test advances it.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)}
+}
+
+// run calls job at the clock's current time and fails the test on error.
+func run(t *testing.T, job Job, clock Clock) {
+	t.Helper()
+	if err := job(context.Background(), clock.Now()); err != nil {
+		t.Fatalf("job failed: %v", err)
+	}
+}
+
+// seedItem creates a seller, a buyer and an item of the seller.
+func seedItem(t *testing.T, db *gorm.DB) (seller, buyer models.User, item models.Item) {
+	t.Helper()
+	seller = models.User{Name: "Seller", Email: fmt.Sprintf("seller-%s@example.com", t.Name()), Password: "x", Role: models.RoleSeller}
+	buyer = models.User{Name: "Buyer", Email: fmt.Sprintf("buyer-%s@example.com", t.Name()), Password: "x", Role: models.RoleBuyer}
+	testdb.Create(t, db, &seller, &buyer)
+	item = models.Item{Title: "Drill", Category: "Tools", Status: models.StatusAvailable, Duration: 7, Quantity: 1, SellerID: seller.ID}
+	testdb.Create(t, db, &item)
+	return seller, buyer, item
+}
+
+// seedLoan creates a request for item in the given status and dates.
+func seedLoan(t *testing.T, db *gorm.DB, item models.Item, buyerID uint, status models.Status, start, end time.Time) models.BorrowRequest {
+	t.Helper()
+	br := models.BorrowRequest{ItemID: item.ID, BuyerID: buyerID, Status: status, StartDate: start, EndDate: end, Quantity: 1}
+	testdb.Create(t, db, &br)
+	return br
+}
+
+// statusOf reloads a request's status.
+func statusOf(t *testing.T, db *gorm.DB, id uint) models.Status {
+	t.Helper()
+	var br models.BorrowRequest
+	if err := db.First(&br, id).Error; err != nil {
+		t.Fatalf("loading request %d: %v", id, err)
+	}
+	return br.Status
+}
@@ -0,0 +1,17 @@
+package jobs
+
+import "log"
+
+// Notifier delivers messages to users. Jobs send reminders through it.
+type Notifier interface {
+	Notify(userID uint, subject, body string) error
+}
+
+// LogNotifier writes notifications to the server log. It is used until a
+// real delivery channel such as email is configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(userID uint, subject, body string) error {
+	log.Printf("Notify user %d: %s: %s", userID, subject, body)
+	return nil
+}
@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+)
+
+// MarkOverdueLoans returns a job that moves picked-up loans past their end
+// date to overdue.
+func MarkOverdueLoans(db *gorm.DB) Job {
+	return func(ctx context.Context, now time.Time) error {
+		var late []models.BorrowRequest
+		if err := db.WithContext(ctx).
+			Where("status = ? AND end_date <= ?", models.StatusActive, now).
+			Find(&late).Error; err != nil {
+			return err
+		}
+
+		for i := range late {
+			if err := late[i].TransitionTo(models.StatusOverdue, models.ActorSystem); err != nil {
+				return err
+			}
+			result := db.WithContext(ctx).Model(&models.BorrowRequest{}).
+				Where("id = ? AND status = ?", late[i].ID, models.StatusActive).
+				Updates(map[string]interface{}{"status": late[i].Status, "overdue_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				log.Printf("Borrow request %d is overdue", late[i].ID)
+			}
+		}
+		return nil
+	}
+}
+
+// SendLoanReminders returns a job that reminds buyers about their due date.
+// offsets are relative to the end date and sorted ascending, e.g. -24h, 0 and
+// 72h; each fires once. Reminders sent after the due date also go to the
+// seller.
+func SendLoanReminders(db *gorm.DB, notifier Notifier, offsets []time.Duration) Job {
+	return func(ctx context.Context, now time.Time) error {
+		if len(offsets) == 0 {
+			return nil
+		}
+
+		var loans []models.BorrowRequest
+		if err := db.WithContext(ctx).Preload("Item").
+			Where("status IN ? AND reminders_sent < ? AND end_date <= ?",
+				[]models.Status{models.StatusActive, models.StatusOverdue},
+				len(offsets), now.Add(-offsets[0])).
+			Find(&loans).Error; err != nil {
+			return err
+		}
+
+		for _, loan := range loans {
+			// Find the latest step that is due; earlier missed steps are
+			// skipped rather than sent in a burst.
+			step := loan.RemindersSent
+			for step < len(offsets) && !now.Before(loan.EndDate.Add(offsets[step])) {
+				step++
+			}
+			if step == loan.RemindersSent {
+				continue
+			}
+			offset := offsets[step-1]
+
+			subject, body := reminderMessage(loan, offset)
+			if err := notifier.Notify(loan.BuyerID, subject, body); err != nil {
+				log.Printf("Failed to send reminder for request %d: %v", loan.ID, err)
+				continue
+			}
+			if offset > 0 {
+				if err := notifier.Notify(loan.Item.SellerID, subject, body); err != nil {
+					log.Printf("Failed to notify seller for request %d: %v", loan.ID, err)
+				}
+			}
+
+			if err := db.WithContext(ctx).Model(&models.BorrowRequest{}).
+				Where("id = ?", loan.ID).
+				Update("reminders_sent", step).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func reminderMessage(loan models.BorrowRequest, offset time.Duration) (string, string) {
+	due := loan.EndDate.Format("2006-01-02")
+	switch {
+	case offset < 0:
+		return "Return reminder", fmt.Sprintf("%q is due back on %s.", loan.Item.Title, due)
+	case offset == 0:
+		return "Item due today", fmt.Sprintf("%q is due back today (%s).", loan.Item.Title, due)
+	default:
+		return "Item overdue", fmt.Sprintf("%q was due back on %s and is now %s late.", loan.Item.Title, due, offset)
+	}
+}
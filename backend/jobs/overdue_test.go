@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"resource-sharing/models"
+	"resource-sharing/testdb"
+)
+
+type notification struct {
+	userID  uint
+	subject string
+}
+
+// recordingNotifier is a Notifier that keeps every message it is given.
+type recordingNotifier struct {
+	sent []notification
+}
+
+func (n *recordingNotifier) Notify(userID uint, subject, body string) error {
+	n.sent = append(n.sent, notification{userID: userID, subject: subject})
+	return nil
+}
+
+func TestMarkOverdueLoans(t *testing.T) {
+	db := testdb.Open(t)
+	clock := newFakeClock()
+	_, buyer, item := seedItem(t, db)
+
+	now := clock.Now()
+	loan := seedLoan(t, db, item, buyer.ID, models.StatusActive, now.Add(-48*time.Hour), now.Add(time.Hour))
+	job := MarkOverdueLoans(db)
+
+	run(t, job, clock)
+	if got := statusOf(t, db, loan.ID); got != models.StatusActive {
+		t.Fatalf("loan before its end date is %s, want active", got)
+	}
+
+	clock.Advance(2 * time.Hour)
+	run(t, job, clock)
+	var reloaded models.BorrowRequest
+	db.First(&reloaded, loan.ID)
+	if reloaded.Status != models.StatusOverdue {
+		t.Fatalf("loan past its end date is %s, want overdue", reloaded.Status)
+	}
+	if reloaded.OverdueAt == nil || !reloaded.OverdueAt.Equal(clock.Now()) {
+		t.Errorf("overdueAt = %v, want %s", reloaded.OverdueAt, clock.Now())
+	}
+}
+
+func TestSendLoanReminders(t *testing.T) {
+	db := testdb.Open(t)
+	clock := newFakeClock()
+	seller, buyer, item := seedItem(t, db)
+
+	now := clock.Now()
+	end := now.Add(36 * time.Hour)
+	loan := seedLoan(t, db, item, buyer.ID, models.StatusActive, now.Add(-48*time.Hour), end)
+
+	notifier := &recordingNotifier{}
+	job := SendLoanReminders(db, notifier, []time.Duration{-24 * time.Hour, 0, 72 * time.Hour})
+
+	// Nothing is due more than a day before the end date
+	run(t, job, clock)
+	if len(notifier.sent) != 0 {
+		t.Fatalf("sent %v before the first reminder was due", notifier.sent)
+	}
+
+	// A day before, the buyer gets one reminder, and only once
+	clock.Advance(13 * time.Hour)
+	run(t, job, clock)
+	run(t, job, clock)
+	if len(notifier.sent) != 1 || notifier.sent[0].userID != buyer.ID || notifier.sent[0].subject != "Return reminder" {
+		t.Fatalf("sent %v, want one return reminder to the buyer", notifier.sent)
+	}
+
+	// Three days late both parties hear about it, skipping the missed
+	// due-today step rather than sending it late
+	clock.Advance(4 * 24 * time.Hour)
+	db.Model(&models.BorrowRequest{}).Where("id = ?", loan.ID).Update("status", models.StatusOverdue)
+	run(t, job, clock)
+	if len(notifier.sent) != 3 {
+		t.Fatalf("sent %v, want an overdue notice to buyer and seller", notifier.sent)
+	}
+	for i, want := range []uint{buyer.ID, seller.ID} {
+		if got := notifier.sent[1+i]; got.userID != want || got.subject != "Item overdue" {
+			t.Errorf("notification %d = %+v, want overdue notice to user %d", 1+i, got, want)
+		}
+	}
+
+	var reloaded models.BorrowRequest
+	db.First(&reloaded, loan.ID)
+	if reloaded.RemindersSent != 3 {
+		t.Errorf("remindersSent = %d, want 3", reloaded.RemindersSent)
+	}
+}
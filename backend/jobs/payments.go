@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/payments"
+)
+
+// RetryPendingPayments returns a job that retries the processor calls of
+// ledger transactions still pending, such as those whose call failed or was
+// interrupted after the loan change committed.
+func RetryPendingPayments(db *gorm.DB, processor payments.Processor) Job {
+	return func(ctx context.Context, now time.Time) error {
+		return payments.FlushAll(db.WithContext(ctx), processor)
+	}
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+)
+
+// PublishClosedReviewWindows returns a job that publishes hidden reviews once
+// window has passed since the loan was returned, even if the other party
+// never reviewed.
+func PublishClosedReviewWindows(db *gorm.DB, window time.Duration) Job {
+	return func(ctx context.Context, now time.Time) error {
+		var requestIDs []uint
+		if err := db.WithContext(ctx).Model(&models.Review{}).
+			Joins("JOIN borrow_requests ON reviews.borrow_request_id = borrow_requests.id").
+			Where("reviews.published_at IS NULL AND borrow_requests.returned_at <= ?", now.Add(-window)).
+			Distinct().
+			Pluck("reviews.borrow_request_id", &requestIDs).Error; err != nil {
+			return err
+		}
+
+		for _, id := range requestIDs {
+			err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return models.PublishReviews(tx, id, now)
+			})
+			if err != nil {
+				return err
+			}
+			log.Printf("Published reviews of borrow request %d after the review window closed", id)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunsJobsAtClockTime(t *testing.T) {
+	clock := newFakeClock()
+	ran := make(chan time.Time, 1)
+
+	s := NewScheduler(clock)
+	s.Every("record", time.Hour, func(ctx context.Context, now time.Time) error {
+		select {
+		case ran <- now:
+		default:
+		}
+		return nil
+	})
+	s.Start(context.Background())
+	defer s.Stop()
+
+	select {
+	case now := <-ran:
+		if !now.Equal(clock.Now()) {
+			t.Errorf("job ran at %s, want the clock's %s", now, clock.Now())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run at start")
+	}
+}
+
+func TestSchedulerSkipsNonPositiveIntervals(t *testing.T) {
+	s := NewScheduler(newFakeClock())
+	noop := func(ctx context.Context, now time.Time) error { return nil }
+	s.Every("zero", 0, noop)
+	s.Every("negative", -time.Minute, noop)
+
+	if len(s.jobs) != 0 {
+		t.Fatalf("scheduled %d jobs, want none", len(s.jobs))
+	}
+	// Starting must not panic on a zero ticker interval
+	s.Start(context.Background())
+	s.Stop()
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+)
+
+// ExpireWaitlistOffers returns a job that expires unclaimed waitlist offers
+// and passes each item on to the next buyer in line, who gets window to claim
+// it.
+func ExpireWaitlistOffers(db *gorm.DB, window time.Duration) Job {
+	return func(ctx context.Context, now time.Time) error {
+		var lapsed []models.WaitlistEntry
+		if err := db.WithContext(ctx).
+			Where("status = ? AND offer_expires_at <= ?", models.StatusOffered, now).
+			Find(&lapsed).Error; err != nil {
+			return err
+		}
+
+		for _, entry := range lapsed {
+			err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&models.WaitlistEntry{}).
+					Where("id = ? AND status = ?", entry.ID, models.StatusOffered).
+					Update("status", models.StatusExpired).Error; err != nil {
+					return err
+				}
+				next, err := models.OfferNextWaitlistEntry(tx, entry.ItemID, now, window)
+				if err != nil {
+					return err
+				}
+				if next != nil {
+					log.Printf("Offered item %d to waitlisted buyer %d", next.ItemID, next.BuyerID)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			log.Printf("Waitlist offer %d for item %d expired", entry.ID, entry.ItemID)
+		}
+		return nil
+	}
+}
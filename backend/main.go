@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -11,9 +18,12 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"resource-sharing/geo"
 	"resource-sharing/handlers"
+	"resource-sharing/jobs"
 	"resource-sharing/middleware"
 	"resource-sharing/models"
+	"resource-sharing/payments"
 )
 
 func main() {
@@ -35,7 +45,31 @@ func main() {
 	}
 
 	// Auto migrate the schema
-	db.AutoMigrate(&models.User{}, &models.Item{}, &models.BorrowRequest{})
+	models.AutoMigrate(db)
+
+	if err := models.MigrateItemCategories(db); err != nil {
+		log.Printf("Warning: failed to migrate item categories: %v", err)
+	}
+
+	if err := models.MigrateItemUnits(db); err != nil {
+		log.Printf("Warning: failed to create item units: %v", err)
+	}
+
+	if err := models.EnsureSearchIndex(db); err != nil {
+		log.Printf("Warning: failed to create item search index: %v", err)
+	}
+
+	handlers.WaitlistClaimWindow = envDuration("WAITLIST_CLAIM_WINDOW", handlers.WaitlistClaimWindow)
+	handlers.ReviewWindow = envDuration("REVIEW_WINDOW", handlers.ReviewWindow)
+	handlers.MaxActiveLoansPerBuyer = envInt("MAX_ACTIVE_LOANS_PER_BUYER", handlers.MaxActiveLoansPerBuyer)
+
+	// No payment provider is integrated yet, so deposits and fees are only
+	// recorded in the ledger
+	processor := payments.NewFakeProcessor()
+
+	// No geocoding service is integrated yet either, so addresses are only
+	// located when sellers give coordinates
+	geocoder := geo.NewStubGeocoder()
 
 	// Initialize router
 	r := mux.NewRouter()
@@ -48,19 +82,76 @@ func main() {
 	r.HandleFunc("/api/items", handlers.GetItems(db)).Methods("GET")
 	r.HandleFunc("/api/my-items", middleware.AuthMiddleware(handlers.GetMyItems(db))).Methods("GET") 
 	r.HandleFunc("/api/items/{id}", handlers.GetItem(db)).Methods("GET")
-	r.HandleFunc("/api/items", middleware.AuthMiddleware(handlers.CreateItem(db))).Methods("POST")
-	r.HandleFunc("/api/items/{id}", middleware.AuthMiddleware(handlers.UpdateItem(db))).Methods("PUT")
+	r.HandleFunc("/api/items/{id}/location", middleware.AuthMiddleware(handlers.GetItemLocation(db))).Methods("GET")
+	r.HandleFunc("/api/items/{id}/availability", handlers.GetItemAvailability(db)).Methods("GET")
+	r.HandleFunc("/api/items/{id}/units", handlers.GetItemUnits(db)).Methods("GET")
+	r.HandleFunc("/api/items/{id}/units/{unitId}", middleware.AuthMiddleware(handlers.UpdateItemUnit(db))).Methods("PUT")
+	r.HandleFunc("/api/items/{id}/waitlist", middleware.AuthMiddleware(handlers.JoinWaitlist(db))).Methods("POST")
+	r.HandleFunc("/api/items/{id}/waitlist", middleware.AuthMiddleware(handlers.LeaveWaitlist(db))).Methods("DELETE")
+	r.HandleFunc("/api/items/{id}/waitlist", middleware.AuthMiddleware(handlers.GetItemWaitlist(db))).Methods("GET")
+	r.HandleFunc("/api/my-waitlist", middleware.AuthMiddleware(handlers.GetMyWaitlist(db))).Methods("GET")
+	r.HandleFunc("/api/items", middleware.AuthMiddleware(handlers.CreateItem(db, geocoder))).Methods("POST")
+	r.HandleFunc("/api/items/{id}", middleware.AuthMiddleware(handlers.UpdateItem(db, geocoder))).Methods("PUT")
 	r.HandleFunc("/api/items/{id}", middleware.AuthMiddleware(handlers.DeleteItem(db))).Methods("DELETE")
 
 	// Borrow request routes
 	r.HandleFunc("/api/borrow-requests", middleware.AuthMiddleware(handlers.CreateBorrowRequest(db))).Methods("POST")
+	r.HandleFunc("/api/borrow-requests/recurring", middleware.AuthMiddleware(handlers.CreateRecurringBorrowRequest(db))).Methods("POST")
+	r.HandleFunc("/api/borrow-requests/bulk", middleware.AuthMiddleware(handlers.CreateBulkBorrowRequest(db))).Methods("POST")
 	r.HandleFunc("/api/borrow-requests/{id}/approve", middleware.AuthMiddleware(handlers.ApproveBorrowRequest(db))).Methods("PUT")
 	r.HandleFunc("/api/borrow-requests/{id}/deny", middleware.AuthMiddleware(handlers.DenyBorrowRequest(db))).Methods("PUT")
+	r.HandleFunc("/api/borrow-requests/{id}/handoff", middleware.AuthMiddleware(handlers.GetHandoffCodes(db))).Methods("GET")
+	r.HandleFunc("/api/borrow-requests/{id}/pickup", middleware.AuthMiddleware(handlers.ConfirmPickup(db, processor))).Methods("PUT")
+	r.HandleFunc("/api/borrow-requests/{id}/condition-reports", middleware.AuthMiddleware(handlers.CreateConditionReport(db))).Methods("POST")
+	r.HandleFunc("/api/condition-reports/{id}/acknowledge", middleware.AuthMiddleware(handlers.AcknowledgeConditionReport(db))).Methods("PUT")
+	r.HandleFunc("/api/condition-reports/{id}", middleware.AuthMiddleware(handlers.WithdrawConditionReport(db))).Methods("DELETE")
+	r.HandleFunc("/api/borrow-requests/{id}/disputes", middleware.AuthMiddleware(handlers.OpenDispute(db))).Methods("POST")
+	r.HandleFunc("/api/borrow-requests/{id}/ledger", middleware.AuthMiddleware(handlers.GetLedger(db))).Methods("GET")
+	r.HandleFunc("/api/borrow-requests/{id}/reviews", middleware.AuthMiddleware(handlers.CreateReview(db))).Methods("POST")
+	r.HandleFunc("/api/borrow-groups/{id}", middleware.AuthMiddleware(handlers.GetBorrowGroup(db))).Methods("GET")
+	r.HandleFunc("/api/borrow-groups/{id}/approve", middleware.AuthMiddleware(handlers.ApproveBorrowGroup(db))).Methods("PUT")
+	r.HandleFunc("/api/borrow-groups/{id}/deny", middleware.AuthMiddleware(handlers.DenyBorrowGroup(db))).Methods("PUT")
+	r.HandleFunc("/api/borrow-requests/{id}/audit", middleware.AuthMiddleware(handlers.GetBorrowRequestAudit(db))).Methods("GET")
+	r.HandleFunc("/api/borrow-requests/{id}/cancel", middleware.AuthMiddleware(handlers.CancelBorrowRequest(db))).Methods("PUT")
+	r.HandleFunc("/api/borrow-requests/{id}/return", middleware.AuthMiddleware(handlers.MarkBorrowRequestReturned(db))).Methods("PUT")
+	r.HandleFunc("/api/borrow-requests/{id}/confirm-return", middleware.AuthMiddleware(handlers.ConfirmBorrowRequestReturn(db, processor))).Methods("PUT")
+	r.HandleFunc("/api/borrow-requests/{id}/extensions", middleware.AuthMiddleware(handlers.RequestLoanExtension(db))).Methods("POST")
+	r.HandleFunc("/api/borrow-requests/{id}/extensions", middleware.AuthMiddleware(handlers.GetLoanExtensions(db))).Methods("GET")
+	r.HandleFunc("/api/borrow-requests/{id}/extensions/{extensionId}/approve", middleware.AuthMiddleware(handlers.ApproveLoanExtension(db, processor))).Methods("PUT")
+	r.HandleFunc("/api/borrow-requests/{id}/extensions/{extensionId}/deny", middleware.AuthMiddleware(handlers.DenyLoanExtension(db))).Methods("PUT")
 	r.HandleFunc("/api/my-requests", middleware.AuthMiddleware(handlers.GetMyBorrowRequests(db))).Methods("GET")
 	r.HandleFunc("/api/my-items/requests", middleware.AuthMiddleware(handlers.GetRequestsForMyItems(db))).Methods("GET")
+	r.HandleFunc("/api/my-requests/overdue", middleware.AuthMiddleware(handlers.GetMyOverdueRequests(db))).Methods("GET")
+	r.HandleFunc("/api/my-items/overdue", middleware.AuthMiddleware(handlers.GetMyOverdueItems(db))).Methods("GET")
 	
+	// Auto-approval rule routes
+	r.HandleFunc("/api/auto-approval-rules", middleware.AuthMiddleware(handlers.GetAutoApprovalRules(db))).Methods("GET")
+	r.HandleFunc("/api/auto-approval-rules", middleware.AuthMiddleware(handlers.CreateAutoApprovalRule(db))).Methods("POST")
+	r.HandleFunc("/api/auto-approval-rules/{id}", middleware.AuthMiddleware(handlers.UpdateAutoApprovalRule(db))).Methods("PUT")
+	r.HandleFunc("/api/auto-approval-rules/{id}", middleware.AuthMiddleware(handlers.DeleteAutoApprovalRule(db))).Methods("DELETE")
+
+	// Category routes
+	r.HandleFunc("/api/categories", handlers.GetCategories(db)).Methods("GET")
+	r.HandleFunc("/api/categories", middleware.AuthMiddleware(handlers.CreateCategory(db))).Methods("POST")
+	r.HandleFunc("/api/categories/{id}", middleware.AuthMiddleware(handlers.UpdateCategory(db))).Methods("PUT")
+	r.HandleFunc("/api/categories/{id}", middleware.AuthMiddleware(handlers.DeleteCategory(db))).Methods("DELETE")
+	r.HandleFunc("/api/categories/{id}/attributes", handlers.GetCategoryAttributes(db)).Methods("GET")
+	r.HandleFunc("/api/categories/{id}/attributes", middleware.AuthMiddleware(handlers.UpdateCategoryAttributes(db))).Methods("PUT")
+
+	// Dispute routes
+	r.HandleFunc("/api/disputes", middleware.AuthMiddleware(handlers.GetDisputes(db))).Methods("GET")
+	r.HandleFunc("/api/disputes/{id}", middleware.AuthMiddleware(handlers.GetDispute(db))).Methods("GET")
+	r.HandleFunc("/api/disputes/{id}/statements", middleware.AuthMiddleware(handlers.AddDisputeStatement(db))).Methods("POST")
+	r.HandleFunc("/api/disputes/{id}/evidence", middleware.AuthMiddleware(handlers.AddDisputeEvidence(db))).Methods("POST")
+	r.HandleFunc("/api/disputes/{id}/resolve", middleware.AuthMiddleware(handlers.ResolveDispute(db, processor))).Methods("PUT")
+
 // User routes
 	r.HandleFunc("/api/me", middleware.AuthMiddleware(handlers.GetCurrentUser(db))).Methods("GET")
+	r.HandleFunc("/api/me/lending-settings", middleware.AuthMiddleware(handlers.UpdateLendingSettings(db))).Methods("PUT")
+	r.HandleFunc("/api/blocked-buyers", middleware.AuthMiddleware(handlers.GetBlockedBuyers(db))).Methods("GET")
+	r.HandleFunc("/api/blocked-buyers", middleware.AuthMiddleware(handlers.BlockBuyer(db))).Methods("POST")
+	r.HandleFunc("/api/blocked-buyers/{buyerId}", middleware.AuthMiddleware(handlers.UnblockBuyer(db))).Methods("DELETE")
+	r.HandleFunc("/api/users/{id}/reviews", handlers.GetUserReviews(db)).Methods("GET")
 
 	// Configure CORS
 	c := cors.New(cors.Options{
@@ -77,6 +168,89 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, c.Handler(r)))
+	// Stop the server and background jobs on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start background jobs
+	scheduler := jobs.NewScheduler(jobs.RealClock{})
+	jobInterval := envDuration("JOB_INTERVAL", 5*time.Minute)
+	scheduler.Every("expire-waitlist-offers", jobInterval, jobs.ExpireWaitlistOffers(db, handlers.WaitlistClaimWindow))
+	scheduler.Every("expire-pending-requests", jobInterval,
+		jobs.ExpirePendingRequests(db, envDuration("PENDING_REQUEST_SLA", 72*time.Hour)))
+	scheduler.Every("expire-missed-pickups", jobInterval, jobs.ExpireMissedPickups(db, handlers.WaitlistClaimWindow))
+	scheduler.Every("mark-overdue-loans", jobInterval, jobs.MarkOverdueLoans(db))
+	scheduler.Every("publish-closed-review-windows", jobInterval, jobs.PublishClosedReviewWindows(db, handlers.ReviewWindow))
+	scheduler.Every("retry-pending-payments", jobInterval, jobs.RetryPendingPayments(db, processor))
+	scheduler.Every("send-loan-reminders", jobInterval, jobs.SendLoanReminders(db, jobs.LogNotifier{},
+		envDurations("LOAN_REMINDER_OFFSETS", []time.Duration{-24 * time.Hour, 0, 72 * time.Hour})))
+	scheduler.Start(ctx)
+
+	server := &http.Server{Addr: ":" + port, Handler: c.Handler(r)}
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
+	}
+	scheduler.Stop()
+}
+
+// envDuration reads a positive Go duration such as "30m" from the
+// environment, falling back to def when the variable is unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: invalid %s %q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// envInt reads an integer from the environment, falling back to def when the
+// variable is unset or invalid.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// envDurations reads a comma-separated list of durations such as
+// "-24h,0s,72h", falling back to def when the variable is unset or invalid.
+func envDurations(key string, def []time.Duration) []time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var ds []time.Duration
+	for _, part := range strings.Split(v, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			log.Printf("Warning: invalid %s %q, using defaults", key, v)
+			return def
+		}
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	return ds
 }
\ No newline at end of file
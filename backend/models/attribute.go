@@ -0,0 +1,255 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// AttributeType is the kind of value a category attribute holds.
+type AttributeType string
+
+const (
+	AttributeEnum    AttributeType = "enum"
+	AttributeNumber  AttributeType = "number"
+	AttributeBoolean AttributeType = "boolean"
+)
+
+var ErrInvalidAttribute = errors.New("invalid attribute")
+
+// CategoryAttribute defines a typed attribute that items of a category and
+// of its subcategories can have. A subcategory may redefine an attribute
+// with the same key.
+type CategoryAttribute struct {
+	ID         uint          `json:"id" gorm:"primaryKey"`
+	CategoryID uint          `json:"categoryId" gorm:"not null;uniqueIndex:idx_category_attribute"`
+	Key        string        `json:"key" gorm:"not null;uniqueIndex:idx_category_attribute"`
+	Label      string        `json:"label"`
+	Type       AttributeType `json:"type" gorm:"not null"`
+	// Options lists the values an enum attribute allows.
+	Options  []string `json:"options,omitempty" gorm:"serializer:json"`
+	Unit     string   `json:"unit,omitempty"`
+	Required bool     `json:"required"`
+}
+
+// ItemAttribute is an item's value for one attribute of its category. Value
+// is kept in canonical form: numbers as strconv formats them, booleans as
+// true or false and enums as the matching option.
+type ItemAttribute struct {
+	ID     uint   `json:"-" gorm:"primaryKey"`
+	ItemID uint   `json:"-" gorm:"not null;uniqueIndex:idx_item_attribute"`
+	Key    string `json:"key" gorm:"not null;uniqueIndex:idx_item_attribute;index:idx_item_attribute_value"`
+	Value  string `json:"value" gorm:"not null;index:idx_item_attribute_value"`
+}
+
+// Normalize slugifies the key and checks the type and enum options.
+func (a *CategoryAttribute) Normalize() error {
+	a.Key = Slugify(a.Key)
+	if a.Key == "" {
+		return fmt.Errorf("%w: key must contain letters or digits", ErrInvalidAttribute)
+	}
+	if a.Label == "" {
+		a.Label = a.Key
+	}
+
+	switch a.Type {
+	case AttributeNumber, AttributeBoolean:
+		a.Options = nil
+	case AttributeEnum:
+		seen := make(map[string]bool)
+		var options []string
+		for _, option := range a.Options {
+			option = strings.TrimSpace(option)
+			if option == "" || seen[strings.ToLower(option)] {
+				continue
+			}
+			seen[strings.ToLower(option)] = true
+			options = append(options, option)
+		}
+		if len(options) == 0 {
+			return fmt.Errorf("%w: enum %s needs at least one option", ErrInvalidAttribute, a.Key)
+		}
+		a.Options = options
+	default:
+		return fmt.Errorf("%w: %s must be of type enum, number or boolean", ErrInvalidAttribute, a.Key)
+	}
+	return nil
+}
+
+// parseValue checks v against the attribute's type and returns its
+// canonical form. Values may be given as JSON values or as strings.
+func (a *CategoryAttribute) parseValue(v interface{}) (string, error) {
+	text, isText := v.(string)
+	text = strings.TrimSpace(text)
+	switch a.Type {
+	case AttributeNumber:
+		f, ok := v.(float64)
+		if isText {
+			parsed, err := strconv.ParseFloat(text, 64)
+			f, ok = parsed, err == nil
+		}
+		if ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64), nil
+		}
+		return "", fmt.Errorf("%w: %s must be a number", ErrInvalidAttribute, a.Key)
+	case AttributeBoolean:
+		b, ok := v.(bool)
+		if isText {
+			parsed, err := strconv.ParseBool(text)
+			b, ok = parsed, err == nil
+		}
+		if ok {
+			return strconv.FormatBool(b), nil
+		}
+		return "", fmt.Errorf("%w: %s must be true or false", ErrInvalidAttribute, a.Key)
+	case AttributeEnum:
+		for _, option := range a.Options {
+			if isText && strings.EqualFold(text, option) {
+				return option, nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s must be one of %s", ErrInvalidAttribute, a.Key, strings.Join(a.Options, ", "))
+	}
+	return "", fmt.Errorf("%w: %s has unknown type %s", ErrInvalidAttribute, a.Key, a.Type)
+}
+
+// AttributeSchema returns the attributes items of a category can have: its
+// own and those inherited from its ancestors, sorted by key.
+func AttributeSchema(db *gorm.DB, categoryID uint) ([]CategoryAttribute, error) {
+	// Walk up to the root, nearest category first
+	var chain []uint
+	seen := make(map[uint]bool)
+	for id := &categoryID; id != nil && !seen[*id]; {
+		seen[*id] = true
+		chain = append(chain, *id)
+		var category Category
+		if err := db.Select("id", "parent_id").First(&category, *id).Error; err != nil {
+			return nil, err
+		}
+		id = category.ParentID
+	}
+
+	var defined []CategoryAttribute
+	if err := db.Where("category_id IN ?", chain).Find(&defined).Error; err != nil {
+		return nil, err
+	}
+	depth := make(map[uint]int, len(chain))
+	for i, id := range chain {
+		depth[id] = i
+	}
+	byKey := make(map[string]CategoryAttribute)
+	for _, a := range defined {
+		if existing, ok := byKey[a.Key]; !ok || depth[a.CategoryID] < depth[existing.CategoryID] {
+			byKey[a.Key] = a
+		}
+	}
+
+	schema := make([]CategoryAttribute, 0, len(byKey))
+	for _, a := range byKey {
+		schema = append(schema, a)
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Key < schema[j].Key })
+	return schema, nil
+}
+
+// BuildItemAttributes validates attribute values against a schema and
+// returns them in canonical form, sorted by key.
+func BuildItemAttributes(schema []CategoryAttribute, values map[string]interface{}) ([]ItemAttribute, error) {
+	byKey := make(map[string]*CategoryAttribute, len(schema))
+	for i := range schema {
+		byKey[schema[i].Key] = &schema[i]
+	}
+
+	var attrs []ItemAttribute
+	for key, v := range values {
+		a, ok := byKey[Slugify(key)]
+		if !ok {
+			return nil, fmt.Errorf("%w: this category has no attribute %s", ErrInvalidAttribute, key)
+		}
+		if v == nil {
+			continue
+		}
+		value, err := a.parseValue(v)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, ItemAttribute{Key: a.Key, Value: value})
+	}
+
+	for _, a := range schema {
+		if !a.Required {
+			continue
+		}
+		found := false
+		for _, attr := range attrs {
+			found = found || attr.Key == a.Key
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s is required", ErrInvalidAttribute, a.Key)
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs, nil
+}
+
+// CarryOverAttributes returns the stored values that schema still defines and
+// accepts, for updates that keep an item's values without restating them.
+// Values of attributes the schema dropped or redefined incompatibly are left
+// out rather than failing the update.
+func CarryOverAttributes(schema []CategoryAttribute, attrs []ItemAttribute) map[string]interface{} {
+	byKey := make(map[string]*CategoryAttribute, len(schema))
+	for i := range schema {
+		byKey[schema[i].Key] = &schema[i]
+	}
+	values := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		a, ok := byKey[attr.Key]
+		if !ok {
+			continue
+		}
+		if _, err := a.parseValue(attr.Value); err != nil {
+			continue
+		}
+		values[attr.Key] = attr.Value
+	}
+	return values
+}
+
+// SetItemAttributes replaces the item's attribute values.
+func SetItemAttributes(tx *gorm.DB, item *Item, attrs []ItemAttribute) error {
+	if err := tx.Where("item_id = ?", item.ID).Delete(&ItemAttribute{}).Error; err != nil {
+		return err
+	}
+	for i := range attrs {
+		attrs[i].ItemID = item.ID
+	}
+	if len(attrs) > 0 {
+		if err := tx.Create(&attrs).Error; err != nil {
+			return err
+		}
+	}
+	item.Attributes = attrs
+	return nil
+}
+
+// WithAttribute restricts an item query to items whose attribute key has
+// the given value. The value is compared in every canonical form it can take,
+// so numbers match whatever way they are written, such as 18 and 18.0,
+// booleans match as 1, t or true, and other values match ignoring case.
+func WithAttribute(query *gorm.DB, key, value string) *gorm.DB {
+	value = strings.TrimSpace(value)
+	candidates := []string{strings.ToLower(value)}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		candidates = append(candidates, strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		candidates = append(candidates, strconv.FormatBool(b))
+	}
+	return query.Where("EXISTS (SELECT 1 FROM item_attributes WHERE item_attributes.item_id = items.id "+
+		"AND item_attributes.key = ? AND LOWER(item_attributes.value) IN ?)", Slugify(key), candidates)
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEntry records who changed a borrow request and why. Automatic actions
+// carry the rule that triggered them.
+type AuditEntry struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	BorrowRequestID uint      `json:"borrowRequestId" gorm:"not null;index"`
+	Action          Status    `json:"action" gorm:"not null"`
+	Actor           Actor     `json:"actor" gorm:"not null"`
+	ActorID         *uint     `json:"actorId"`
+	RuleID          *uint     `json:"ruleId"`
+	Detail          string    `json:"detail"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
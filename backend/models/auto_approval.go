@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AutoApprovalRule lets a seller approve requests without reviewing them by
+// hand. A rule with no ItemID applies to all of the seller's items. Zero
+// values disable the corresponding condition.
+type AutoApprovalRule struct {
+	ID                  uint      `json:"id" gorm:"primaryKey"`
+	SellerID            uint      `json:"sellerId" gorm:"not null;index"`
+	ItemID              *uint     `json:"itemId" gorm:"index"`
+	MinCompletedReturns int       `json:"minCompletedReturns"`
+	RequireNoDisputes   bool      `json:"requireNoDisputes"`
+	MaxLoanDays         int       `json:"maxLoanDays"`
+	Enabled             bool      `json:"enabled"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+// BuyerHistory is what auto-approval rules know about a buyer.
+type BuyerHistory struct {
+	CompletedReturns int64
+	Disputes         int64
+}
+
+// LoadBuyerHistory counts the buyer's returned loans and the disputes raised
+// on any of their loans.
+func LoadBuyerHistory(db *gorm.DB, buyerID uint) (BuyerHistory, error) {
+	var h BuyerHistory
+	if err := db.Model(&BorrowRequest{}).
+		Where("buyer_id = ? AND status = ?", buyerID, StatusReturned).
+		Count(&h.CompletedReturns).Error; err != nil {
+		return h, err
+	}
+	err := db.Model(&Dispute{}).
+		Joins("JOIN borrow_requests ON disputes.borrow_request_id = borrow_requests.id").
+		Where("borrow_requests.buyer_id = ?", buyerID).
+		Count(&h.Disputes).Error
+	return h, err
+}
+
+// Matches reports whether the rule approves a loan of loanDays for a buyer
+// with the given history.
+func (r *AutoApprovalRule) Matches(h BuyerHistory, loanDays int) bool {
+	if !r.Enabled {
+		return false
+	}
+	if h.CompletedReturns < int64(r.MinCompletedReturns) {
+		return false
+	}
+	if r.RequireNoDisputes && h.Disputes > 0 {
+		return false
+	}
+	if r.MaxLoanDays > 0 && loanDays > r.MaxLoanDays {
+		return false
+	}
+	return true
+}
+
+// Describe explains the rule in words for the audit log.
+func (r *AutoApprovalRule) Describe() string {
+	var conds []string
+	if r.MinCompletedReturns > 0 {
+		conds = append(conds, fmt.Sprintf("buyer has at least %d completed returns", r.MinCompletedReturns))
+	}
+	if r.RequireNoDisputes {
+		conds = append(conds, "buyer has no disputes")
+	}
+	if r.MaxLoanDays > 0 {
+		conds = append(conds, fmt.Sprintf("loan is at most %d day(s)", r.MaxLoanDays))
+	}
+	scope := "all items"
+	if r.ItemID != nil {
+		scope = fmt.Sprintf("item %d", *r.ItemID)
+	}
+	if len(conds) == 0 {
+		return fmt.Sprintf("rule %d (%s): approve every request", r.ID, scope)
+	}
+	return fmt.Sprintf("rule %d (%s): %s", r.ID, scope, strings.Join(conds, ", "))
+}
+
+// FindMatchingAutoApprovalRule returns the first enabled rule of the seller
+// that approves the request, preferring item-specific rules over global ones.
+// It returns nil if no rule matches.
+func FindMatchingAutoApprovalRule(db *gorm.DB, sellerID uint, br *BorrowRequest) (*AutoApprovalRule, error) {
+	var rules []AutoApprovalRule
+	if err := db.Where("seller_id = ? AND enabled = ? AND (item_id = ? OR item_id IS NULL)", sellerID, true, br.ItemID).
+		Order("item_id IS NULL, id").
+		Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	history, err := LoadBuyerHistory(db, br.BuyerID)
+	if err != nil {
+		return nil, err
+	}
+
+	days := LoanDays(br.StartDate, br.EndDate)
+	for i := range rules {
+		if rules[i].Matches(history, days) {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BookedStatuses are the borrow request statuses that hold an item for their
+// date range.
+var BookedStatuses = []Status{StatusApproved, StatusActive, StatusOverdue}
+
+// Interval is a half-open time range [Start, End).
+type Interval struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	RequestID uint      `json:"requestId,omitempty"`
+	// Quantity is the number of units booked during the interval.
+	Quantity int `json:"quantity,omitempty"`
+}
+
+// Overlaps reports whether the two half-open ranges share any instant.
+func Overlaps(aStart, aEnd, bStart, bEnd time.Time) bool {
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+// FindConflictingRequests returns the booked requests for an item that
+// overlap the given range. excludeID skips a request, typically the one
+// being checked; pass 0 to include all.
+func FindConflictingRequests(db *gorm.DB, itemID uint, start, end time.Time, excludeID uint) ([]BorrowRequest, error) {
+	var conflicts []BorrowRequest
+	query := db.Where("item_id = ? AND status IN ? AND start_date < ? AND end_date > ?", itemID, BookedStatuses, end, start)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	err := query.Order("start_date").Find(&conflicts).Error
+	return conflicts, err
+}
+
+// FreeIntervals returns the parts of [from, to) not covered by booked.
+func FreeIntervals(from, to time.Time, booked []Interval) []Interval {
+	sorted := make([]Interval, len(booked))
+	copy(sorted, booked)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	var free []Interval
+	cursor := from
+	for _, b := range sorted {
+		if !b.End.After(cursor) {
+			continue
+		}
+		if b.Start.After(cursor) {
+			end := b.Start
+			if end.After(to) {
+				end = to
+			}
+			if end.After(cursor) {
+				free = append(free, Interval{Start: cursor, End: end})
+			}
+		}
+		cursor = b.End
+		if !cursor.Before(to) {
+			return free
+		}
+	}
+	if cursor.Before(to) {
+		free = append(free, Interval{Start: cursor, End: to})
+	}
+	return free
+}
+
+func sortTimes(ts []time.Time) {
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Before(ts[j]) })
+}
+
+// DenyOverlappingPending denies every pending request for the same item, or
+// for an item sharing units with it through a bundle, whose dates overlap
+// the approved request and that no longer fits in the free units. Each is
+// moved through TransitionTo as the system actor and gets reason recorded.
+// It returns the number of requests denied.
+func DenyOverlappingPending(db *gorm.DB, approved *BorrowRequest, reason string) (int64, error) {
+	var item Item
+	if err := db.First(&item, approved.ItemID).Error; err != nil {
+		return 0, err
+	}
+	related, err := RelatedItemIDs(db, &item)
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []BorrowRequest
+	if err := db.Preload("Item").
+		Where("item_id IN ? AND status = ? AND id <> ? AND start_date < ? AND end_date > ?",
+			related, StatusPending, approved.ID, approved.EndDate, approved.StartDate).
+		Find(&pending).Error; err != nil || len(pending) == 0 {
+		return 0, err
+	}
+
+	var denied int64
+	for i := range pending {
+		p := &pending[i]
+		err := CheckCapacity(db, &p.Item, p.StartDate, p.EndDate, p.Quantity, 0)
+		if errors.Is(err, ErrNotEnoughRoom) {
+			if err := p.TransitionTo(StatusDenied, ActorSystem); err != nil {
+				return denied, err
+			}
+			p.DenialReason = reason
+			if err := db.Model(p).Updates(map[string]interface{}{"status": p.Status, "denial_reason": p.DenialReason}).Error; err != nil {
+				return denied, err
+			}
+			denied++
+		} else if err != nil {
+			return denied, err
+		}
+	}
+	return denied, nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// BorrowGroupKind says how the requests in a group were created.
+type BorrowGroupKind string
+
+const (
+	// BorrowGroupBulk groups requests for several items over the same
+	// dates. They are approved or denied together.
+	BorrowGroupBulk BorrowGroupKind = "bulk"
+	// BorrowGroupRecurring groups the occurrences of a recurring request
+	// for one item.
+	BorrowGroupRecurring BorrowGroupKind = "recurring"
+)
+
+// BorrowGroup ties together borrow requests a buyer made in one go. Every
+// request in a group belongs to items of the same seller.
+type BorrowGroup struct {
+	ID       uint            `json:"id" gorm:"primaryKey"`
+	Kind     BorrowGroupKind `json:"kind" gorm:"not null"`
+	BuyerID  uint            `json:"buyerId" gorm:"not null;index"`
+	SellerID uint            `json:"sellerId" gorm:"not null;index"`
+	// Recurrence is the RRULE a recurring group was expanded from.
+	Recurrence string          `json:"recurrence,omitempty"`
+	Requests   []BorrowRequest `json:"requests,omitempty" gorm:"foreignKey:GroupID"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+}
@@ -13,7 +13,39 @@ type BorrowRequest struct {
 	Status    Status    `json:"status" gorm:"not null"`
 	StartDate time.Time `json:"startDate" gorm:"not null"`
 	EndDate   time.Time `json:"endDate" gorm:"not null"`
-	Message   string    `json:"message"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-}
\ No newline at end of file
+	// Quantity is how many units of the item the request reserves. Units
+	// holds the ones handed out at pickup.
+	Quantity int        `json:"quantity" gorm:"default:1"`
+	Units    []ItemUnit `json:"units,omitempty" gorm:"many2many:borrow_request_units"`
+	Message  string     `json:"message"`
+	// GroupID links requests made together as a bulk or recurring request.
+	GroupID *uint `json:"groupId" gorm:"index"`
+	// NeedsOverride marks requests that break the item's loan policy and
+	// were sent to the seller for a manual decision.
+	NeedsOverride bool `json:"needsOverride"`
+	// DenialReason explains why a request was denied, either as given by
+	// the seller or generated by the system.
+	DenialReason string `json:"denialReason"`
+	// PickupCode and ReturnCode are the one-time codes the buyer shows at
+	// handoff. They are only revealed to the buyer.
+	PickupCode string `json:"-"`
+	ReturnCode string `json:"-"`
+	// HandoffAttempts counts codes entered for the current handoff since
+	// the buyer was last shown their code.
+	HandoffAttempts int        `json:"-" gorm:"not null;default:0"`
+	ApprovedAt      *time.Time `json:"approvedAt"`
+	PickedUpAt      *time.Time `json:"pickedUpAt"`
+	// ReturnRequestedAt is set when the buyer reports the item as handed
+	// back; ReturnedAt is set once the seller confirms it.
+	ReturnRequestedAt *time.Time `json:"returnRequestedAt"`
+	ReturnedAt        *time.Time `json:"returnedAt"`
+	CancelledAt       *time.Time `json:"cancelledAt"`
+	OverdueAt         *time.Time `json:"overdueAt"`
+	// RemindersSent counts the due-date reminders already sent, so each
+	// escalation step fires once.
+	RemindersSent    int               `json:"remindersSent"`
+	Extensions       []LoanExtension   `json:"extensions,omitempty" gorm:"foreignKey:BorrowRequestID"`
+	ConditionReports []ConditionReport `json:"conditionReports,omitempty" gorm:"foreignKey:BorrowRequestID"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrBuyerBlocked is returned when a seller has blocked the buyer.
+var ErrBuyerBlocked = errors.New("the owner of this item is not accepting requests from you")
+
+// ErrLoanLimitReached is returned when a buyer already holds as many units as
+// they are allowed to.
+var ErrLoanLimitReached = errors.New("active loan limit reached")
+
+// BlockedBuyer stops a buyer from requesting any of a seller's items.
+type BlockedBuyer struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SellerID  uint      `json:"sellerId" gorm:"not null;uniqueIndex:idx_blocked_buyer"`
+	BuyerID   uint      `json:"buyerId" gorm:"not null;uniqueIndex:idx_blocked_buyer"`
+	Buyer     User      `json:"buyer" gorm:"foreignKey:BuyerID"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// LimitedStatuses are the borrow request statuses that count towards a
+// buyer's loan limits. Pending requests are included so a buyer cannot queue
+// more requests than they would be allowed to hold.
+var LimitedStatuses = append([]Status{StatusPending}, BookedStatuses...)
+
+// IsBuyerBlocked reports whether the seller has blocked the buyer.
+func IsBuyerBlocked(db *gorm.DB, sellerID, buyerID uint) (bool, error) {
+	var count int64
+	err := db.Model(&BlockedBuyer{}).
+		Where("seller_id = ? AND buyer_id = ?", sellerID, buyerID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CountActiveLoans counts the units the buyer holds or has requested through
+// requests in LimitedStatuses. A non-zero sellerID restricts the count to
+// that seller's items.
+func CountActiveLoans(db *gorm.DB, buyerID, sellerID uint) (int64, error) {
+	query := db.Model(&BorrowRequest{}).
+		Where("borrow_requests.buyer_id = ? AND borrow_requests.status IN ?", buyerID, LimitedStatuses)
+	if sellerID != 0 {
+		query = query.Joins("JOIN items ON items.id = borrow_requests.item_id").
+			Where("items.seller_id = ?", sellerID)
+	}
+	var count int64
+	err := query.Select("COALESCE(SUM(borrow_requests.quantity), 0)").Scan(&count).Error
+	return count, err
+}
+
+// LockBuyer locks the buyer's user row until tx ends, so that requests by the
+// same buyer are counted against their limits one at a time.
+func LockBuyer(tx *gorm.DB, buyerID uint) error {
+	var buyer User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&buyer, buyerID).Error
+}
+
+// CheckBorrowingLimits checks whether the buyer may request requested more
+// units of seller's items. globalMax caps the units the buyer holds across
+// all sellers and seller.MaxLoansPerBuyer those held from this seller; zero
+// means no limit. A refusal wraps ErrBuyerBlocked or ErrLoanLimitReached.
+func CheckBorrowingLimits(db *gorm.DB, buyerID uint, seller *User, requested, globalMax int) error {
+	blocked, err := IsBuyerBlocked(db, seller.ID, buyerID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBuyerBlocked
+	}
+
+	if globalMax > 0 {
+		count, err := CountActiveLoans(db, buyerID, 0)
+		if err != nil {
+			return err
+		}
+		if count+int64(requested) > int64(globalMax) {
+			return fmt.Errorf("%w: you may hold at most %d items at a time", ErrLoanLimitReached, globalMax)
+		}
+	}
+
+	if seller.MaxLoansPerBuyer > 0 {
+		count, err := CountActiveLoans(db, buyerID, seller.ID)
+		if err != nil {
+			return err
+		}
+		if count+int64(requested) > int64(seller.MaxLoansPerBuyer) {
+			return fmt.Errorf("%w: this lender allows at most %d items per borrower", ErrLoanLimitReached, seller.MaxLoansPerBuyer)
+		}
+	}
+	return nil
+}
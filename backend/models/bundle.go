@@ -0,0 +1,166 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ItemKind tells single items apart from bundles.
+type ItemKind string
+
+const (
+	ItemKindSingle ItemKind = "single"
+	// ItemKindBundle items are kits of other items that are lent together.
+	// A bundle has no units of its own; booking it books one unit of each
+	// component per unit requested.
+	ItemKindBundle ItemKind = "bundle"
+)
+
+var ErrInvalidBundle = errors.New("a bundle needs at least two of your own items, none of them bundles")
+
+// IsBundle reports whether the item is a bundle of other items.
+func (i *Item) IsBundle() bool {
+	return i.Kind == ItemKindBundle
+}
+
+// LoadBundleComponents returns the seller's items with the given IDs if they
+// can form a bundle.
+func LoadBundleComponents(db *gorm.DB, sellerID uint, ids []uint) ([]Item, error) {
+	if len(ids) < 2 {
+		return nil, ErrInvalidBundle
+	}
+	var components []Item
+	if err := db.Where("id IN ?", ids).Find(&components).Error; err != nil {
+		return nil, err
+	}
+	if len(components) != len(ids) {
+		return nil, ErrInvalidBundle
+	}
+	for _, c := range components {
+		if c.SellerID != sellerID || c.IsBundle() {
+			return nil, ErrInvalidBundle
+		}
+	}
+	return components, nil
+}
+
+// BundlesContaining returns the IDs of the bundles that include any of the
+// items.
+func BundlesContaining(db *gorm.DB, itemIDs []uint) ([]uint, error) {
+	var ids []uint
+	err := db.Table("bundle_components").
+		Where("component_id IN ?", itemIDs).
+		Distinct().
+		Pluck("bundle_id", &ids).Error
+	return ids, err
+}
+
+// physicalItems returns the items whose units a booking of item uses: the
+// components of a bundle, or the item itself.
+func physicalItems(db *gorm.DB, item *Item) ([]Item, error) {
+	if !item.IsBundle() {
+		return []Item{*item}, nil
+	}
+	if item.Components != nil {
+		return item.Components, nil
+	}
+	// Association queries list every column, including the search-only ones
+	// that are not in the table, so the components are selected directly
+	var components []Item
+	err := db.Where("id IN (?)", db.Table("bundle_components").Select("component_id").Where("bundle_id = ?", item.ID)).
+		Order("id").
+		Find(&components).Error
+	return components, err
+}
+
+// FindBookingsUsing returns the booked requests overlapping [start, end) that
+// use units of the physical item, whether they booked it directly or through
+// a bundle. excludeID is as in FindConflictingRequests.
+func FindBookingsUsing(db *gorm.DB, itemID uint, start, end time.Time, excludeID uint) ([]BorrowRequest, error) {
+	bundles, err := BundlesContaining(db, []uint{itemID})
+	if err != nil {
+		return nil, err
+	}
+
+	var bookings []BorrowRequest
+	query := db.Where("item_id IN ? AND status IN ? AND start_date < ? AND end_date > ?",
+		append(bundles, itemID), BookedStatuses, end, start)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	err = query.Order("start_date").Find(&bookings).Error
+	return bookings, err
+}
+
+// FindRelatedBookings returns the booked requests overlapping [start, end)
+// that compete with bookings of item, as listed by RelatedItemIDs.
+func FindRelatedBookings(db *gorm.DB, item *Item, start, end time.Time) ([]BorrowRequest, error) {
+	related, err := RelatedItemIDs(db, item)
+	if err != nil {
+		return nil, err
+	}
+	var bookings []BorrowRequest
+	err = db.Where("item_id IN ? AND status IN ? AND start_date < ? AND end_date > ?", related, BookedStatuses, end, start).
+		Order("start_date").
+		Find(&bookings).Error
+	return bookings, err
+}
+
+// RelatedItemIDs returns the items whose bookings compete with bookings of
+// item: the item, its components, and every bundle sharing a component.
+func RelatedItemIDs(db *gorm.DB, item *Item) ([]uint, error) {
+	physical, err := physicalItems(db, item)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(physical)+1)
+	for _, p := range physical {
+		ids = append(ids, p.ID)
+	}
+	bundles, err := BundlesContaining(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	if item.IsBundle() {
+		ids = append(ids, item.ID)
+	}
+	for _, b := range bundles {
+		if b != item.ID {
+			ids = append(ids, b)
+		}
+	}
+	return ids, nil
+}
+
+// LockRelatedItems locks the rows of item and every item listed by
+// RelatedItemIDs until the transaction ends, so that two transactions
+// booking units of the same items run one after the other. Rows are locked
+// in ID order to avoid deadlocks, so callers must not lock some of them
+// beforehand. It must run inside a transaction.
+func LockRelatedItems(tx *gorm.DB, item *Item) error {
+	ids, err := RelatedItemIDs(tx, item)
+	if err != nil {
+		return err
+	}
+	return LockItems(tx, ids)
+}
+
+// LockItems locks the rows of the given items until the transaction ends, in
+// ID order. Transactions that lock several items must take all of them in
+// one call, since locking them in separate calls can deadlock against a
+// transaction taking the same rows in another order. It must run inside a
+// transaction.
+func LockItems(tx *gorm.DB, ids []uint) error {
+	sorted := append([]uint(nil), ids...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	var locked []Item
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id IN ?", sorted).
+		Order("id").
+		Find(&locked).Error
+}
@@ -0,0 +1,90 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"resource-sharing/models"
+	"resource-sharing/testdb"
+)
+
+// TestBundleCapacity books a bundle of a two-unit and a one-unit item next to
+// a direct booking of the shared two-unit component.
+func TestBundleCapacity(t *testing.T) {
+	db := testdb.Open(t)
+	seller, buyer := seedUsers(t, db)
+	paddle := seedItem(t, db, seller.ID, "Paddle", 2)
+	canoe := seedItem(t, db, seller.ID, "Canoe", 1)
+	kit := models.Item{
+		Title: "Canoe kit", Status: models.StatusAvailable, Duration: 30, Quantity: 1,
+		SellerID: seller.ID, Kind: models.ItemKindBundle, Components: []models.Item{paddle, canoe},
+	}
+	testdb.Create(t, db, &kit)
+
+	book(t, db, paddle.ID, buyer.ID, models.StatusApproved, 1, 3, 1)
+	book(t, db, kit.ID, buyer.ID, models.StatusActive, 2, 4, 1)
+
+	// loadKit reloads the bundle so its components are read from the database
+	loadKit := func() models.Item {
+		var item models.Item
+		if err := db.First(&item, kit.ID).Error; err != nil {
+			t.Fatalf("loading bundle: %v", err)
+		}
+		return item
+	}
+	bundle := loadKit()
+
+	tests := []struct {
+		name     string
+		item     *models.Item
+		from, to int
+		full     bool
+	}{
+		{"component used directly and by the bundle", &paddle, 2, 3, true},
+		{"component used by the bundle only", &paddle, 3, 4, false},
+		{"component free after the bundle", &paddle, 4, 5, false},
+		{"bundle beside the direct booking", &bundle, 1, 2, false},
+		{"bundle while its single unit component is out", &bundle, 3, 4, true},
+		{"bundle once the bundle booking ends", &bundle, 4, 5, false},
+		{"other component used by the bundle", &canoe, 2, 3, true},
+	}
+	for _, tt := range tests {
+		err := models.CheckCapacity(db, tt.item, day(tt.from), day(tt.to), 1, 0)
+		if tt.full && !errors.Is(err, models.ErrNotEnoughRoom) {
+			t.Errorf("%s: got %v, want ErrNotEnoughRoom", tt.name, err)
+		}
+		if !tt.full && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	// The bundle has as many units free as its scarcest component
+	steps, err := models.RemainingUnits(db, &bundle, day(0), day(5))
+	if err != nil {
+		t.Fatalf("remaining units: %v", err)
+	}
+	checkSteps(t, steps, []step{
+		{0, 1, 1},
+		{1, 2, 1},
+		{2, 3, 0},
+		{3, 4, 0},
+		{4, 5, 1},
+	})
+
+	// A frozen component makes the bundle unbookable, but not its siblings
+	if err := db.Model(&canoe).Update("status", models.StatusFrozen).Error; err != nil {
+		t.Fatalf("freezing component: %v", err)
+	}
+	bundle = loadKit()
+	if err := models.CheckCapacity(db, &bundle, day(4), day(5), 1, 0); !errors.Is(err, models.ErrNotEnoughRoom) {
+		t.Errorf("frozen component: got %v, want ErrNotEnoughRoom", err)
+	}
+	if err := models.CheckCapacity(db, &paddle, day(4), day(5), 1, 0); err != nil {
+		t.Errorf("sibling of frozen component: unexpected error %v", err)
+	}
+	steps, err = models.RemainingUnits(db, &bundle, day(4), day(5))
+	if err != nil {
+		t.Fatalf("remaining units: %v", err)
+	}
+	checkSteps(t, steps, []step{{4, 5, 0}})
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownCategory = errors.New("unknown category")
+	ErrCategoryCycle   = errors.New("a category cannot be placed under itself or one of its subcategories")
+	ErrCategoryInUse   = errors.New("category still has subcategories or items")
+)
+
+// DefaultCategories are created when the category table is first set up.
+var DefaultCategories = []string{"Tools", "Electronics", "Books", "Sports", "Outdoor", "Kitchen", "Furniture", "Clothing", "Other"}
+
+// Category is a node of the item category tree. Items filed under a
+// category also match searches for any of its ancestors.
+type Category struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Name      string     `json:"name" gorm:"not null"`
+	Slug      string     `json:"slug" gorm:"uniqueIndex;not null"`
+	ParentID  *uint      `json:"parentId" gorm:"index"`
+	Children  []Category `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Slugify turns a category name into its slug, e.g. "Power Tools" into
+// "power-tools".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// FindCategory looks a category up by ID or, when id is zero, by slug or
+// name, ignoring case.
+func FindCategory(db *gorm.DB, id uint, ref string) (*Category, error) {
+	var category Category
+	var err error
+	if id != 0 {
+		err = db.First(&category, id).Error
+	} else {
+		slug := Slugify(ref)
+		if slug == "" {
+			return nil, ErrUnknownCategory
+		}
+		err = db.Where("slug = ?", slug).First(&category).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownCategory
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// CategoryTree returns the top-level categories with their subcategories
+// nested under them, each level sorted by name.
+func CategoryTree(db *gorm.DB) ([]Category, error) {
+	var all []Category
+	if err := db.Order("name").Find(&all).Error; err != nil {
+		return nil, err
+	}
+	children := make(map[uint][]Category)
+	var roots []Category
+	for _, c := range all {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+	var attach func(cs []Category) []Category
+	attach = func(cs []Category) []Category {
+		for i := range cs {
+			cs[i].Children = attach(children[cs[i].ID])
+		}
+		return cs
+	}
+	return attach(roots), nil
+}
+
+// CategoryAndDescendants returns the IDs of a category and every category
+// below it.
+func CategoryAndDescendants(db *gorm.DB, id uint) ([]uint, error) {
+	var all []Category
+	if err := db.Select("id", "parent_id").Find(&all).Error; err != nil {
+		return nil, err
+	}
+	children := make(map[uint][]uint)
+	for _, c := range all {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+		}
+	}
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+// CheckCategoryParent returns ErrCategoryCycle if making parentID the
+// parent of category id would put the category under itself.
+func CheckCategoryParent(db *gorm.DB, id, parentID uint) error {
+	below, err := CategoryAndDescendants(db, id)
+	if err != nil {
+		return err
+	}
+	for _, c := range below {
+		if c == parentID {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
+
+// CheckCategoryUnused returns ErrCategoryInUse if the category has
+// subcategories or items filed under it.
+func CheckCategoryUnused(db *gorm.DB, id uint) error {
+	var children, items int64
+	if err := db.Model(&Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&Item{}).Where("category_id = ?", id).Count(&items).Error; err != nil {
+		return err
+	}
+	if children > 0 || items > 0 {
+		return ErrCategoryInUse
+	}
+	return nil
+}
+
+// MigrateItemCategories files items that only have a free-text category
+// under a managed one. Names that differ only in case or punctuation, such
+// as "Tools" and "tools", share a category; unknown names become new
+// top-level categories. The default categories are created on first run.
+func MigrateItemCategories(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Category{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			for _, name := range DefaultCategories {
+				if err := tx.Create(&Category{Name: name, Slug: Slugify(name)}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		var names []string
+		if err := tx.Model(&Item{}).
+			Where("category_id IS NULL AND category <> ''").
+			Distinct().Pluck("category", &names).Error; err != nil {
+			return err
+		}
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			category, err := FindCategory(tx, 0, name)
+			if errors.Is(err, ErrUnknownCategory) {
+				if Slugify(name) == "" {
+					continue
+				}
+				category = &Category{Name: name, Slug: Slugify(name)}
+				err = tx.Create(category).Error
+			}
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&Item{}).
+				Where("category_id IS NULL AND TRIM(category) = ?", name).
+				Updates(map[string]interface{}{"category_id": category.ID, "category": category.Name}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
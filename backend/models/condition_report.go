@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrReportUnacknowledged is returned when a handoff is confirmed while its
+// condition report still waits for one party's acknowledgement.
+var ErrReportUnacknowledged = errors.New("the condition report must be acknowledged by both the buyer and the seller first")
+
+// ConditionReport records the state of an item at pickup or return. Both the
+// buyer and the seller acknowledge it so it can serve as evidence later, and
+// a handoff with a report cannot be confirmed until they have.
+type ConditionReport struct {
+	ID                   uint             `json:"id" gorm:"primaryKey"`
+	BorrowRequestID      uint             `json:"borrowRequestId" gorm:"not null;index"`
+	Stage                HandoffKind      `json:"stage" gorm:"not null"`
+	ReporterID           uint             `json:"reporterId" gorm:"not null"`
+	Rating               int              `json:"rating" gorm:"not null"`
+	Notes                string           `json:"notes"`
+	Photos               []ConditionPhoto `json:"photos" gorm:"foreignKey:ConditionReportID"`
+	BuyerAcknowledgedAt  *time.Time       `json:"buyerAcknowledgedAt"`
+	SellerAcknowledgedAt *time.Time       `json:"sellerAcknowledgedAt"`
+	CreatedAt            time.Time        `json:"createdAt"`
+	UpdatedAt            time.Time        `json:"updatedAt"`
+}
+
+type ConditionPhoto struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	ConditionReportID uint      `json:"conditionReportId" gorm:"not null;index"`
+	URL               string    `json:"url" gorm:"not null"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// CheckReportAcknowledged returns ErrReportUnacknowledged if the request has
+// a report for stage that the buyer or the seller has not acknowledged.
+// Reports are optional, so a stage without one passes. So does a loan with a
+// dispute: the parties disagree, and the admin resolving the dispute decides
+// on the condition instead.
+func CheckReportAcknowledged(db *gorm.DB, borrowRequestID uint, stage HandoffKind) error {
+	var disputes int64
+	if err := db.Model(&Dispute{}).Where("borrow_request_id = ?", borrowRequestID).Count(&disputes).Error; err != nil {
+		return err
+	}
+	if disputes > 0 {
+		return nil
+	}
+
+	var pending int64
+	if err := db.Model(&ConditionReport{}).
+		Where("borrow_request_id = ? AND stage = ?", borrowRequestID, stage).
+		Where("buyer_acknowledged_at IS NULL OR seller_acknowledged_at IS NULL").
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return ErrReportUnacknowledged
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DisputeOutcome is an admin's ruling on a dispute.
+type DisputeOutcome string
+
+const (
+	OutcomeNoFault       DisputeOutcome = "no_fault"
+	OutcomePartialCharge DisputeOutcome = "partial_charge"
+	OutcomeFullCharge    DisputeOutcome = "full_charge"
+)
+
+// Dispute is raised by either party of a loan when an item comes back
+// damaged or not at all. While any dispute on an item is open the item is
+// frozen and cannot be booked.
+type Dispute struct {
+	ID              uint               `json:"id" gorm:"primaryKey"`
+	BorrowRequestID uint               `json:"borrowRequestId" gorm:"not null;index"`
+	BorrowRequest   BorrowRequest      `json:"borrowRequest" gorm:"foreignKey:BorrowRequestID"`
+	OpenedByID      uint               `json:"openedById" gorm:"not null"`
+	Reason          string             `json:"reason" gorm:"not null"`
+	Status          Status             `json:"status" gorm:"not null"`
+	Outcome         DisputeOutcome     `json:"outcome"`
+	ChargeCents     int64              `json:"chargeCents"`
+	ResolutionNotes string             `json:"resolutionNotes"`
+	ResolvedByID    *uint              `json:"resolvedById"`
+	ResolvedAt      *time.Time         `json:"resolvedAt"`
+	Statements      []DisputeStatement `json:"statements" gorm:"foreignKey:DisputeID"`
+	Evidence        []DisputeEvidence  `json:"evidence" gorm:"foreignKey:DisputeID"`
+	CreatedAt       time.Time          `json:"createdAt"`
+	UpdatedAt       time.Time          `json:"updatedAt"`
+}
+
+// DisputeStatement is one message in the exchange between the parties and
+// the admin.
+type DisputeStatement struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	DisputeID uint      `json:"disputeId" gorm:"not null;index"`
+	AuthorID  uint      `json:"authorId" gorm:"not null"`
+	Body      string    `json:"body" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DisputeEvidence is a file, typically a photo, attached to a dispute.
+type DisputeEvidence struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	DisputeID     uint      `json:"disputeId" gorm:"not null;index"`
+	SubmittedByID uint      `json:"submittedById" gorm:"not null"`
+	URL           string    `json:"url" gorm:"not null"`
+	Description   string    `json:"description"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Charge returns what the buyer owes for a resolved dispute on br. A full
+// charge costs the deposit of every unit borrowed. br.Item must be loaded.
+func (d *Dispute) Charge(br *BorrowRequest) int64 {
+	switch d.Outcome {
+	case OutcomePartialCharge:
+		return d.ChargeCents
+	case OutcomeFullCharge:
+		return br.Item.DepositCents * int64(br.Quantity)
+	}
+	return 0
+}
+
+// ResolvedDisputeCharges sums the charges of the resolved disputes on a loan.
+func ResolvedDisputeCharges(db *gorm.DB, br *BorrowRequest) (int64, error) {
+	var disputes []Dispute
+	if err := db.Where("borrow_request_id = ? AND status = ?", br.ID, StatusResolved).Find(&disputes).Error; err != nil {
+		return 0, err
+	}
+	var total int64
+	for i := range disputes {
+		total += disputes[i].Charge(br)
+	}
+	return total, nil
+}
+
+// HasOpenDispute reports whether any loan using units of the item, directly
+// or through a bundle containing it, has an open dispute.
+func HasOpenDispute(db *gorm.DB, itemID uint) (bool, error) {
+	bundles, err := BundlesContaining(db, []uint{itemID})
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	err = db.Model(&Dispute{}).
+		Joins("JOIN borrow_requests ON disputes.borrow_request_id = borrow_requests.id").
+		Where("borrow_requests.item_id IN ? AND disputes.status = ?", append(bundles, itemID), StatusOpen).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// FreezeItem freezes an item for a dispute. A bundle's components are frozen
+// with it, since the disputed units belong to them.
+func FreezeItem(db *gorm.DB, item *Item) error {
+	physical, err := physicalItems(db, item)
+	if err != nil {
+		return err
+	}
+	ids := []uint{item.ID}
+	for i := range physical {
+		if physical[i].ID != item.ID {
+			ids = append(ids, physical[i].ID)
+		}
+	}
+	item.Status = StatusFrozen
+	return db.Model(&Item{}).Where("id IN ?", ids).Update("status", StatusFrozen).Error
+}
+
+// UnfreezeItem restores a frozen item, and the components of a frozen
+// bundle, once no open dispute is left on them. Each goes back to borrowed
+// if a loan is still running, otherwise to available.
+func UnfreezeItem(db *gorm.DB, item *Item) error {
+	if err := unfreeze(db, item); err != nil {
+		return err
+	}
+	if !item.IsBundle() {
+		return nil
+	}
+	components, err := physicalItems(db, item)
+	if err != nil {
+		return err
+	}
+	for i := range components {
+		if err := unfreeze(db, &components[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unfreeze(db *gorm.DB, item *Item) error {
+	if item.Status != StatusFrozen {
+		return nil
+	}
+	open, err := HasOpenDispute(db, item.ID)
+	if err != nil || open {
+		return err
+	}
+	if err := releaseParkedUnits(db, item); err != nil {
+		return err
+	}
+
+	bundles, err := BundlesContaining(db, []uint{item.ID})
+	if err != nil {
+		return err
+	}
+	var running int64
+	if err := db.Model(&BorrowRequest{}).
+		Where("item_id IN ? AND status IN ?", append(bundles, item.ID), []Status{StatusActive, StatusOverdue}).
+		Count(&running).Error; err != nil {
+		return err
+	}
+
+	item.Status = StatusAvailable
+	if running > 0 {
+		status, err := UnitStatus(db, item)
+		if err != nil {
+			return err
+		}
+		item.Status = status
+	}
+	return db.Model(item).Update("status", item.Status).Error
+}
+
+// releaseParkedUnits makes available the units of a frozen item that
+// ReleaseUnits kept out after their loan was returned.
+func releaseParkedUnits(db *gorm.DB, item *Item) error {
+	var held []uint
+	if err := db.Table("borrow_request_units").
+		Joins("JOIN borrow_requests ON borrow_requests.id = borrow_request_units.borrow_request_id").
+		Where("borrow_requests.status IN ?", []Status{StatusActive, StatusOverdue}).
+		Pluck("borrow_request_units.item_unit_id", &held).Error; err != nil {
+		return err
+	}
+	query := db.Model(&ItemUnit{}).Where("item_id = ? AND status = ?", item.ID, StatusBorrowed)
+	if len(held) > 0 {
+		query = query.Where("id NOT IN ?", held)
+	}
+	return query.Update("status", StatusAvailable).Error
+}
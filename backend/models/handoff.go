@@ -0,0 +1,76 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// HandoffKind distinguishes the code shown at pickup from the one shown at
+// return.
+type HandoffKind string
+
+const (
+	HandoffPickup HandoffKind = "pickup"
+	HandoffReturn HandoffKind = "return"
+)
+
+// MaxHandoffAttempts is how many codes may be entered for a handoff before it
+// is locked until the buyer is shown a fresh code.
+const MaxHandoffAttempts = 5
+
+// ErrHandoffLocked is returned once a handoff has used up its attempts.
+var ErrHandoffLocked = errors.New("too many handoff codes entered")
+
+// GenerateHandoffCode returns a random six digit one-time code.
+func GenerateHandoffCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// HandoffPayload encodes a code as the string rendered in the buyer's QR code.
+func HandoffPayload(kind HandoffKind, requestID uint, code string) string {
+	return fmt.Sprintf("resourcesharing:%s:%d:%s", kind, requestID, code)
+}
+
+// MatchHandoffCode reports whether input, either the typed code or a scanned
+// QR payload, matches the expected code for the request.
+func MatchHandoffCode(kind HandoffKind, requestID uint, expected, input string) bool {
+	if expected == "" {
+		return false
+	}
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "resourcesharing:") {
+		prefix := HandoffPayload(kind, requestID, "")
+		if !strings.HasPrefix(input, prefix) {
+			return false
+		}
+		input = strings.TrimPrefix(input, prefix)
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(input)) == 1
+}
+
+// UseHandoffAttempt counts an attempt at entering the handoff code of a
+// request, failing with ErrHandoffLocked once MaxHandoffAttempts have been
+// made. Attempts are counted before the code is checked so that concurrent
+// guesses cannot exceed the limit.
+func UseHandoffAttempt(db *gorm.DB, requestID uint) error {
+	result := db.Model(&BorrowRequest{}).
+		Where("id = ? AND handoff_attempts < ?", requestID, MaxHandoffAttempts).
+		Update("handoff_attempts", gorm.Expr("handoff_attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHandoffLocked
+	}
+	return nil
+}
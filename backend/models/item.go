@@ -5,16 +5,61 @@ import (
 )
 
 type Item struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Title       string    `json:"title" gorm:"not null"`
-	Description string    `json:"description"`
-	Category    string    `json:"category"`
-	ImageURL    string    `json:"imageUrl"`
-	Status      Status    `json:"status" gorm:"not null"`
-	Location    string    `json:"location"`
-	Duration    int       `json:"duration" gorm:"default:7"`
-	SellerID    uint      `json:"sellerId" gorm:"not null"`
-	Seller      User      `json:"seller" gorm:"foreignKey:SellerID"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
-}
\ No newline at end of file
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Title       string `json:"title" gorm:"not null"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	ImageURL    string `json:"imageUrl"`
+	Status      Status `json:"status" gorm:"not null"`
+	Location    string `json:"location"`
+	Duration    int    `json:"duration" gorm:"default:7"`
+	// CategoryID files the item under a managed category. Category holds
+	// that category's name for display and search.
+	CategoryID *uint `json:"categoryId" gorm:"index"`
+	// Tags are free-form labels and Attributes the item's values for the
+	// typed attributes its category defines.
+	Tags       []Tag           `json:"tags,omitempty" gorm:"many2many:item_tags"`
+	Attributes []ItemAttribute `json:"attributes,omitempty" gorm:"foreignKey:ItemID"`
+	// Address is the exact pickup address and Latitude/Longitude its
+	// position. They are left out of item listings; buyers see them once a
+	// loan is approved. ApproxLatitude and ApproxLongitude are the position
+	// rounded to about a kilometre, which radius searches use.
+	Address         string   `json:"-"`
+	Latitude        *float64 `json:"-"`
+	Longitude       *float64 `json:"-"`
+	ApproxLatitude  *float64 `json:"latitude,omitempty" gorm:"index:idx_items_approx_position"`
+	ApproxLongitude *float64 `json:"longitude,omitempty" gorm:"index:idx_items_approx_position"`
+	// Distance is only set on radius search results: the distance in km
+	// from the searched point to the approximate position.
+	Distance float64 `json:"distance,omitempty" gorm:"-"`
+	// Quantity is the number of identical units of the item. Each unit can
+	// be lent to a different borrower at the same time.
+	Quantity int        `json:"quantity" gorm:"default:1"`
+	Units    []ItemUnit `json:"units,omitempty" gorm:"foreignKey:ItemID"`
+	// Kind is single or bundle. Components lists the items in a bundle.
+	Kind       ItemKind `json:"kind" gorm:"default:single"`
+	Components []Item   `json:"components,omitempty" gorm:"many2many:bundle_components;joinForeignKey:BundleID;joinReferences:ComponentID"`
+	// MinNoticeDays and MaxAdvanceDays bound how soon and how far ahead a
+	// loan may start. Zero disables the check.
+	MinNoticeDays  int `json:"minNoticeDays"`
+	MaxAdvanceDays int `json:"maxAdvanceDays"`
+	// CancellationWindowHours is how long before the start date a buyer may
+	// still cancel an approved loan. Zero allows cancelling up to the start.
+	CancellationWindowHours int `json:"cancellationWindowHours"`
+	// DepositCents is held from the buyer for the length of a loan and
+	// DailyFeeCents is charged per loan day. Both are optional.
+	DepositCents  int64 `json:"depositCents"`
+	DailyFeeCents int64 `json:"dailyFeeCents"`
+	// RatingAverage and RatingCount summarise the published buyer reviews
+	// of this item.
+	RatingAverage float64 `json:"ratingAverage"`
+	RatingCount   int     `json:"ratingCount"`
+	// SearchRank and SearchSnippet are only set on search results. They are
+	// computed by the query and not stored.
+	SearchRank    float64   `json:"searchRank,omitempty" gorm:"->;-:migration"`
+	SearchSnippet string    `json:"searchSnippet,omitempty" gorm:"->;-:migration"`
+	SellerID      uint      `json:"sellerId" gorm:"not null"`
+	Seller        User      `json:"seller" gorm:"foreignKey:SellerID"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
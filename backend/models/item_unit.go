@@ -0,0 +1,422 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnitsInUse    = errors.New("units that are on loan or in maintenance cannot be removed")
+	ErrNoUnitsFree   = errors.New("not enough units are available to hand out")
+	ErrNotEnoughRoom = errors.New("not enough units are free for the requested dates")
+)
+
+// ItemUnit is one physical copy of an item. An item with a quantity of N has
+// N units, each tracked separately.
+type ItemUnit struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	ItemID uint `json:"itemId" gorm:"not null;index"`
+	// Label tells identical units apart, e.g. by an asset tag. It defaults to
+	// the unit's number within the item.
+	Label string `json:"label"`
+	// Status is available, borrowed or maintenance. Units in maintenance
+	// cannot be booked.
+	Status Status `json:"status" gorm:"not null"`
+	// Condition is the latest condition rating from 1 (poor) to 5
+	// (excellent), or 0 if the unit was never rated.
+	Condition int       `json:"condition"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SyncItemUnits makes the number of units match item.Quantity, adding new
+// available units or removing available ones. It runs when an item is
+// created or updated. Bundles have no units.
+func SyncItemUnits(db *gorm.DB, item *Item) error {
+	if item.IsBundle() {
+		return nil
+	}
+
+	var units []ItemUnit
+	if err := db.Where("item_id = ?", item.ID).Order("id").Find(&units).Error; err != nil {
+		return err
+	}
+
+	for n := len(units) + 1; n <= item.Quantity; n++ {
+		unit := ItemUnit{ItemID: item.ID, Label: fmt.Sprintf("#%d", n), Status: StatusAvailable}
+		if err := db.Create(&unit).Error; err != nil {
+			return err
+		}
+	}
+
+	// Remove the newest available units first
+	excess := len(units) - item.Quantity
+	var remove []uint
+	for i := len(units) - 1; i >= 0 && len(remove) < excess; i-- {
+		if units[i].Status == StatusAvailable {
+			remove = append(remove, units[i].ID)
+		}
+	}
+	if len(remove) < excess {
+		return ErrUnitsInUse
+	}
+	if len(remove) > 0 {
+		return db.Delete(&ItemUnit{}, remove).Error
+	}
+	return nil
+}
+
+// MigrateItemUnits gives items created before units existed their units.
+func MigrateItemUnits(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var items []Item
+		if err := tx.Where("kind IS NULL OR kind <> ?", ItemKindBundle).
+			Where("NOT EXISTS (SELECT 1 FROM item_units WHERE item_units.item_id = items.id)").
+			Find(&items).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			if err := SyncItemUnits(tx, &items[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ItemCapacity returns how many units of the item can be booked, which is
+// its quantity less the units in maintenance. A bundle can be booked as many
+// times as its scarcest component; a frozen component makes it unbookable.
+func ItemCapacity(db *gorm.DB, item *Item) (int, error) {
+	if item.IsBundle() {
+		components, err := physicalItems(db, item)
+		if err != nil || len(components) == 0 {
+			return 0, err
+		}
+		capacity := -1
+		for i := range components {
+			c, err := ItemCapacity(db, &components[i])
+			if err != nil {
+				return 0, err
+			}
+			if components[i].Status == StatusFrozen {
+				c = 0
+			}
+			if capacity < 0 || c < capacity {
+				capacity = c
+			}
+		}
+		return capacity, nil
+	}
+
+	var maintenance int64
+	if err := db.Model(&ItemUnit{}).
+		Where("item_id = ? AND status = ?", item.ID, StatusMaintenance).
+		Count(&maintenance).Error; err != nil {
+		return 0, err
+	}
+	return item.Quantity - int(maintenance), nil
+}
+
+// PeakUsage returns the largest number of units the bookings hold at the same
+// time within [start, end).
+func PeakUsage(bookings []BorrowRequest, start, end time.Time) int {
+	peak := 0
+	for _, step := range UsageSteps(bookings, start, end) {
+		if step.Quantity > peak {
+			peak = step.Quantity
+		}
+	}
+	return peak
+}
+
+// UsageSteps splits [start, end) wherever the bookings start or end and
+// returns each piece with the number of units booked during it in Quantity.
+func UsageSteps(bookings []BorrowRequest, start, end time.Time) []Interval {
+	cuts := []time.Time{start, end}
+	for _, b := range bookings {
+		if b.StartDate.After(start) && b.StartDate.Before(end) {
+			cuts = append(cuts, b.StartDate)
+		}
+		if b.EndDate.After(start) && b.EndDate.Before(end) {
+			cuts = append(cuts, b.EndDate)
+		}
+	}
+	sortTimes(cuts)
+
+	var steps []Interval
+	for i := 0; i+1 < len(cuts); i++ {
+		if !cuts[i].Before(cuts[i+1]) {
+			continue
+		}
+		step := Interval{Start: cuts[i], End: cuts[i+1]}
+		for _, b := range bookings {
+			if Overlaps(b.StartDate, b.EndDate, step.Start, step.End) {
+				step.Quantity += b.Quantity
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// CheckCapacity returns ErrNotEnoughRoom if quantity more units of the item
+// cannot be booked for the whole of [start, end). Bookings made through
+// bundles count against their components, and a bundle needs room in every
+// component. excludeID skips a request as in FindConflictingRequests.
+func CheckCapacity(db *gorm.DB, item *Item, start, end time.Time, quantity int, excludeID uint) error {
+	if item.IsBundle() {
+		components, err := physicalItems(db, item)
+		if err != nil {
+			return err
+		}
+		for i := range components {
+			if components[i].Status == StatusFrozen {
+				return ErrNotEnoughRoom
+			}
+			if err := CheckCapacity(db, &components[i], start, end, quantity, excludeID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	capacity, err := ItemCapacity(db, item)
+	if err != nil {
+		return err
+	}
+	bookings, err := FindBookingsUsing(db, item.ID, start, end, excludeID)
+	if err != nil {
+		return err
+	}
+	if PeakUsage(bookings, start, end)+quantity > capacity {
+		return ErrNotEnoughRoom
+	}
+	return nil
+}
+
+// endOfTime bounds checks that cover every booking from a point onwards.
+var endOfTime = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// CheckBookingsFit returns ErrNotEnoughRoom if the loans already booked on
+// the item from now on no longer fit in its capacity, such as after its
+// quantity was lowered, units were taken out for maintenance or a bundle's
+// components were replaced.
+func CheckBookingsFit(db *gorm.DB, item *Item, now time.Time) error {
+	physical, err := physicalItems(db, item)
+	if err != nil {
+		return err
+	}
+	for i := range physical {
+		if err := CheckCapacity(db, &physical[i], now, endOfTime, 0, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemainingUnits splits [from, to) into steps and returns each with the
+// number of units still free during it in Quantity.
+func RemainingUnits(db *gorm.DB, item *Item, from, to time.Time) ([]Interval, error) {
+	if item.IsBundle() {
+		components, err := physicalItems(db, item)
+		if err != nil {
+			return nil, err
+		}
+		var perComponent [][]Interval
+		for i := range components {
+			steps, err := RemainingUnits(db, &components[i], from, to)
+			if err != nil {
+				return nil, err
+			}
+			if components[i].Status == StatusFrozen {
+				steps = []Interval{{Start: from, End: to}}
+			}
+			perComponent = append(perComponent, steps)
+		}
+		return minSteps(perComponent, from, to), nil
+	}
+
+	capacity, err := ItemCapacity(db, item)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := FindBookingsUsing(db, item.ID, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	steps := UsageSteps(bookings, from, to)
+	for i := range steps {
+		steps[i].Quantity = capacity - steps[i].Quantity
+		if steps[i].Quantity < 0 {
+			steps[i].Quantity = 0
+		}
+	}
+	return steps, nil
+}
+
+// minSteps combines step functions over [from, to), taking the smallest
+// Quantity of any of them at each point.
+func minSteps(all [][]Interval, from, to time.Time) []Interval {
+	if len(all) == 0 {
+		return []Interval{{Start: from, End: to}}
+	}
+	cuts := []time.Time{from, to}
+	for _, steps := range all {
+		for _, s := range steps {
+			cuts = append(cuts, s.Start, s.End)
+		}
+	}
+	sortTimes(cuts)
+
+	var out []Interval
+	for i := 0; i+1 < len(cuts); i++ {
+		if !cuts[i].Before(cuts[i+1]) {
+			continue
+		}
+		step := Interval{Start: cuts[i], End: cuts[i+1], Quantity: -1}
+		for _, steps := range all {
+			for _, s := range steps {
+				if !s.Start.After(step.Start) && s.End.After(step.Start) {
+					if step.Quantity < 0 || s.Quantity < step.Quantity {
+						step.Quantity = s.Quantity
+					}
+					break
+				}
+			}
+		}
+		if step.Quantity < 0 {
+			step.Quantity = 0
+		}
+		out = append(out, step)
+	}
+	return out
+}
+
+// AssignUnits hands out available units of the item, or of each component
+// of a bundle, to a loan that is being picked up and marks them borrowed.
+func AssignUnits(db *gorm.DB, br *BorrowRequest) error {
+	physical, err := physicalItems(db, &br.Item)
+	if err != nil {
+		return err
+	}
+
+	var assigned []ItemUnit
+	for i := range physical {
+		// Units of an item under dispute cannot be handed out
+		if physical[i].Status == StatusFrozen {
+			return ErrNoUnitsFree
+		}
+		var units []ItemUnit
+		if err := db.Where("item_id = ? AND status = ?", physical[i].ID, StatusAvailable).
+			Order("id").Limit(br.Quantity).Find(&units).Error; err != nil {
+			return err
+		}
+		if len(units) < br.Quantity {
+			return ErrNoUnitsFree
+		}
+
+		for j := range units {
+			units[j].Status = StatusBorrowed
+			if err := db.Save(&units[j]).Error; err != nil {
+				return err
+			}
+		}
+		assigned = append(assigned, units...)
+	}
+
+	br.Units = assigned
+	if err := db.Model(br).Association("Units").Replace(assigned); err != nil {
+		return err
+	}
+	return RefreshComponentStatuses(db, &br.Item)
+}
+
+// RefreshComponentStatuses updates the status of a bundle's components after
+// their units were handed out or returned. Frozen components are left alone.
+// It does nothing for single items.
+func RefreshComponentStatuses(db *gorm.DB, item *Item) error {
+	if !item.IsBundle() {
+		return nil
+	}
+	components, err := physicalItems(db, item)
+	if err != nil {
+		return err
+	}
+	for i := range components {
+		if components[i].Status == StatusFrozen {
+			continue
+		}
+		status, err := UnitStatus(db, &components[i])
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&components[i]).Update("status", status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseUnits makes the units of a returned loan available again. Units of
+// frozen items stay out until UnfreezeItem releases them, so disputed units
+// cannot be handed out again while the dispute is open.
+func ReleaseUnits(db *gorm.DB, br *BorrowRequest) error {
+	if err := db.Model(br).Association("Units").Find(&br.Units); err != nil {
+		return err
+	}
+	if len(br.Units) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(br.Units))
+	itemIDs := make([]uint, len(br.Units))
+	for i, unit := range br.Units {
+		ids[i] = unit.ID
+		itemIDs[i] = unit.ItemID
+	}
+	var frozen []uint
+	if err := db.Model(&Item{}).
+		Where("id IN ? AND status = ?", itemIDs, StatusFrozen).
+		Pluck("id", &frozen).Error; err != nil {
+		return err
+	}
+	query := db.Model(&ItemUnit{}).Where("id IN ? AND status = ?", ids, StatusBorrowed)
+	if len(frozen) > 0 {
+		query = query.Where("item_id NOT IN ?", frozen)
+	}
+	return query.Update("status", StatusAvailable).Error
+}
+
+// UnitStatus returns borrowed if every in-service unit of the item is out on
+// loan and available otherwise. A bundle is borrowed once any of its
+// components is.
+func UnitStatus(db *gorm.DB, item *Item) (Status, error) {
+	if item.IsBundle() {
+		components, err := physicalItems(db, item)
+		if err != nil {
+			return "", err
+		}
+		for i := range components {
+			status, err := UnitStatus(db, &components[i])
+			if err != nil || status == StatusBorrowed {
+				return status, err
+			}
+		}
+		return StatusAvailable, nil
+	}
+
+	var available int64
+	if err := db.Model(&ItemUnit{}).
+		Where("item_id = ? AND status = ?", item.ID, StatusAvailable).
+		Count(&available).Error; err != nil {
+		return "", err
+	}
+	if available > 0 {
+		return StatusAvailable, nil
+	}
+	return StatusBorrowed, nil
+}
@@ -0,0 +1,209 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+	"resource-sharing/testdb"
+)
+
+// day returns midnight n days after a fixed Monday.
+func day(n int) time.Time {
+	return time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n)
+}
+
+// seedUsers creates a seller and a buyer.
+func seedUsers(t *testing.T, db *gorm.DB) (models.User, models.User) {
+	t.Helper()
+	seller := models.User{Name: "Seller", Email: "seller@example.com", Password: "x", Role: models.RoleSeller}
+	buyer := models.User{Name: "Buyer", Email: "buyer@example.com", Password: "x", Role: models.RoleBuyer}
+	testdb.Create(t, db, &seller, &buyer)
+	return seller, buyer
+}
+
+// seedItem creates an available item with quantity units.
+func seedItem(t *testing.T, db *gorm.DB, sellerID uint, title string, quantity int) models.Item {
+	t.Helper()
+	item := models.Item{Title: title, Status: models.StatusAvailable, Duration: 30, Quantity: quantity, SellerID: sellerID}
+	testdb.Create(t, db, &item)
+	if err := models.SyncItemUnits(db, &item); err != nil {
+		t.Fatalf("creating units: %v", err)
+	}
+	return item
+}
+
+// book creates a borrow request for quantity units of the item over days
+// [from, to).
+func book(t *testing.T, db *gorm.DB, itemID, buyerID uint, status models.Status, from, to, quantity int) models.BorrowRequest {
+	t.Helper()
+	br := models.BorrowRequest{ItemID: itemID, BuyerID: buyerID, Status: status, Quantity: quantity, StartDate: day(from), EndDate: day(to)}
+	testdb.Create(t, db, &br)
+	return br
+}
+
+// step is an expected Interval over days [from, to).
+type step struct {
+	from, to, quantity int
+}
+
+// checkSteps compares the steps against the expected ones.
+func checkSteps(t *testing.T, got []models.Interval, want []step) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d steps %v, want %d", len(got), got, len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if !g.Start.Equal(day(w.from)) || !g.End.Equal(day(w.to)) || g.Quantity != w.quantity {
+			t.Errorf("step %d = [%s, %s) %d, want days [%d, %d) %d",
+				i, g.Start.Format(time.DateOnly), g.End.Format(time.DateOnly), g.Quantity, w.from, w.to, w.quantity)
+		}
+	}
+}
+
+// TestUsageSteps covers overlapping bookings, bookings that only touch each
+// other or the window, and bookings reaching past it.
+func TestUsageSteps(t *testing.T) {
+	bookings := []models.BorrowRequest{
+		{StartDate: day(-2), EndDate: day(0), Quantity: 5},
+		{StartDate: day(1), EndDate: day(3), Quantity: 1},
+		{StartDate: day(2), EndDate: day(4), Quantity: 2},
+		{StartDate: day(4), EndDate: day(8), Quantity: 1},
+	}
+	checkSteps(t, models.UsageSteps(bookings, day(0), day(6)), []step{
+		{0, 1, 0},
+		{1, 2, 1},
+		{2, 3, 3},
+		{3, 4, 2},
+		{4, 6, 1},
+	})
+	if got := models.PeakUsage(bookings, day(0), day(6)); got != 3 {
+		t.Errorf("peak usage = %d, want 3", got)
+	}
+	checkSteps(t, models.UsageSteps(nil, day(0), day(1)), []step{{0, 1, 0}})
+}
+
+// TestCheckCapacity books a three-unit item with one unit in maintenance, so
+// two units can be booked at a time.
+func TestCheckCapacity(t *testing.T) {
+	db := testdb.Open(t)
+	seller, buyer := seedUsers(t, db)
+	item := seedItem(t, db, seller.ID, "Tent", 3)
+
+	var unit models.ItemUnit
+	if err := db.Where("item_id = ?", item.ID).First(&unit).Error; err != nil {
+		t.Fatalf("loading unit: %v", err)
+	}
+	if err := db.Model(&unit).Update("status", models.StatusMaintenance).Error; err != nil {
+		t.Fatalf("updating unit: %v", err)
+	}
+
+	approved := book(t, db, item.ID, buyer.ID, models.StatusApproved, 1, 3, 1)
+	book(t, db, item.ID, buyer.ID, models.StatusActive, 2, 4, 1)
+	// Neither pending nor finished requests hold units
+	book(t, db, item.ID, buyer.ID, models.StatusPending, 0, 5, 2)
+	book(t, db, item.ID, buyer.ID, models.StatusReturned, 0, 5, 2)
+
+	tests := []struct {
+		name      string
+		from, to  int
+		quantity  int
+		excludeID uint
+		full      bool
+	}{
+		{"both units booked", 2, 3, 1, 0, true},
+		{"starts as a booking ends", 3, 4, 1, 0, false},
+		{"ends as a booking starts", 0, 1, 2, 0, false},
+		{"overlaps one booking", 0, 2, 2, 0, true},
+		{"one unit left", 0, 2, 1, 0, false},
+		{"spans every booking", 0, 5, 1, 0, true},
+		{"after every booking", 4, 6, 2, 0, false},
+		{"more than capacity", 6, 7, 3, 0, true},
+		{"excluded booking", 2, 3, 1, approved.ID, false},
+	}
+	for _, tt := range tests {
+		err := models.CheckCapacity(db, &item, day(tt.from), day(tt.to), tt.quantity, tt.excludeID)
+		if tt.full && !errors.Is(err, models.ErrNotEnoughRoom) {
+			t.Errorf("%s: got %v, want ErrNotEnoughRoom", tt.name, err)
+		}
+		if !tt.full && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	// The unit is bookable again once it leaves maintenance
+	if err := db.Model(&unit).Update("status", models.StatusAvailable).Error; err != nil {
+		t.Fatalf("updating unit: %v", err)
+	}
+	if err := models.CheckCapacity(db, &item, day(2), day(3), 1, 0); err != nil {
+		t.Errorf("after maintenance: unexpected error %v", err)
+	}
+}
+
+// TestRemainingUnits checks the free units of a two-unit item around two
+// overlapping bookings.
+func TestRemainingUnits(t *testing.T) {
+	db := testdb.Open(t)
+	seller, buyer := seedUsers(t, db)
+	item := seedItem(t, db, seller.ID, "Kayak", 2)
+
+	book(t, db, item.ID, buyer.ID, models.StatusApproved, 1, 3, 1)
+	book(t, db, item.ID, buyer.ID, models.StatusOverdue, 2, 4, 1)
+
+	steps, err := models.RemainingUnits(db, &item, day(0), day(5))
+	if err != nil {
+		t.Fatalf("remaining units: %v", err)
+	}
+	checkSteps(t, steps, []step{
+		{0, 1, 2},
+		{1, 2, 1},
+		{2, 3, 0},
+		{3, 4, 1},
+		{4, 5, 2},
+	})
+
+	// Overbooked steps report no free units rather than a negative count
+	if err := db.Model(&item).Update("quantity", 1).Error; err != nil {
+		t.Fatalf("updating item: %v", err)
+	}
+	item.Quantity = 1
+	steps, err = models.RemainingUnits(db, &item, day(2), day(3))
+	if err != nil {
+		t.Fatalf("remaining units: %v", err)
+	}
+	checkSteps(t, steps, []step{{2, 3, 0}})
+}
+
+// TestMigrateItemUnits gives an item without units its units and leaves
+// bundles alone.
+func TestMigrateItemUnits(t *testing.T) {
+	db := testdb.Open(t)
+	seller, _ := seedUsers(t, db)
+	item := models.Item{Title: "Drill", Status: models.StatusAvailable, Quantity: 3, SellerID: seller.ID}
+	bundle := models.Item{Title: "Kit", Status: models.StatusAvailable, Quantity: 1, SellerID: seller.ID, Kind: models.ItemKindBundle}
+	testdb.Create(t, db, &item, &bundle)
+
+	// Running it twice must not add units again
+	for i := 0; i < 2; i++ {
+		if err := models.MigrateItemUnits(db); err != nil {
+			t.Fatalf("migrating units: %v", err)
+		}
+	}
+
+	var units []models.ItemUnit
+	if err := db.Order("id").Find(&units).Error; err != nil {
+		t.Fatalf("loading units: %v", err)
+	}
+	if len(units) != 3 {
+		t.Fatalf("got %d units, want 3", len(units))
+	}
+	for i, u := range units {
+		if u.ItemID != item.ID || u.Status != models.StatusAvailable {
+			t.Errorf("unit %d = %+v, want an available unit of item %d", i, u, item.ID)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LedgerAccount is one side of a ledger posting.
+type LedgerAccount string
+
+const (
+	AccountBuyer  LedgerAccount = "buyer"
+	AccountEscrow LedgerAccount = "escrow"
+	AccountSeller LedgerAccount = "seller"
+)
+
+// LedgerEntryKind names the business event behind a ledger transaction.
+type LedgerEntryKind string
+
+const (
+	EntryDepositHeld     LedgerEntryKind = "deposit_held"
+	EntryFeeCharged      LedgerEntryKind = "fee_charged"
+	EntryExtensionFee    LedgerEntryKind = "extension_fee_charged"
+	EntryDepositRefunded LedgerEntryKind = "deposit_refunded"
+	EntryDamageDeducted  LedgerEntryKind = "damage_deducted"
+)
+
+// LedgerEntryStatus tracks whether the processor has moved the money behind
+// a ledger transaction yet.
+type LedgerEntryStatus string
+
+const (
+	EntryPending LedgerEntryStatus = "pending"
+	EntryPosted  LedgerEntryStatus = "posted"
+)
+
+// LedgerEntry is one line of a double-entry transaction for a loan. Every
+// transaction writes a negative entry on the account money leaves and a
+// positive entry on the account it reaches, so each TransactionID sums to
+// zero. Entries are written pending and marked posted once the processor
+// call for their transaction has succeeded.
+type LedgerEntry struct {
+	ID              uint              `json:"id" gorm:"primaryKey"`
+	BorrowRequestID uint              `json:"borrowRequestId" gorm:"not null;index"`
+	TransactionID   string            `json:"transactionId" gorm:"not null;index"`
+	Kind            LedgerEntryKind   `json:"kind" gorm:"not null"`
+	Account         LedgerAccount     `json:"account" gorm:"not null"`
+	AmountCents     int64             `json:"amountCents" gorm:"not null"`
+	Status          LedgerEntryStatus `json:"status" gorm:"not null;default:posted;index"`
+	ProcessorRef    string            `json:"processorRef"`
+	CreatedAt       time.Time         `json:"createdAt"`
+}
+
+// LedgerBalance returns the balance of one account for a loan.
+func LedgerBalance(db *gorm.DB, borrowRequestID uint, account LedgerAccount) (int64, error) {
+	var balance int64
+	err := db.Model(&LedgerEntry{}).
+		Where("borrow_request_id = ? AND account = ?", borrowRequestID, account).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Scan(&balance).Error
+	return balance, err
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// LoanExtension is a buyer's proposal to move the end date of an approved
+// loan. Every proposal is kept as the loan's extension history.
+type LoanExtension struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	BorrowRequestID  uint       `json:"borrowRequestId" gorm:"not null;index"`
+	PreviousEndDate  time.Time  `json:"previousEndDate" gorm:"not null"`
+	RequestedEndDate time.Time  `json:"requestedEndDate" gorm:"not null"`
+	Status           Status     `json:"status" gorm:"not null"`
+	Message          string     `json:"message"`
+	DenialReason     string     `json:"denialReason"`
+	DecidedAt        *time.Time `json:"decidedAt"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var (
+	ErrLoanTooLong        = errors.New("requested loan is longer than the item's maximum duration")
+	ErrNoticeTooShort     = errors.New("requested start date does not give the seller enough notice")
+	ErrTooFarInAdvance    = errors.New("requested start date is too far in advance")
+	ErrCancellationClosed = errors.New("the cancellation window for this loan has closed")
+)
+
+// LoanDays returns the length of a loan in whole days, rounding partial days
+// up.
+func LoanDays(start, end time.Time) int {
+	return int(math.Ceil(end.Sub(start).Hours() / 24))
+}
+
+// CheckLoanPolicy validates a requested loan against the item's duration,
+// minimum notice and maximum advance booking settings.
+func (i *Item) CheckLoanPolicy(start, end, now time.Time) error {
+	if i.MinNoticeDays > 0 && start.Sub(now) < time.Duration(i.MinNoticeDays)*24*time.Hour {
+		return fmt.Errorf("%w: this item needs at least %d day(s) notice", ErrNoticeTooShort, i.MinNoticeDays)
+	}
+	if i.MaxAdvanceDays > 0 && start.Sub(now) > time.Duration(i.MaxAdvanceDays)*24*time.Hour {
+		return fmt.Errorf("%w: this item can be booked at most %d day(s) ahead", ErrTooFarInAdvance, i.MaxAdvanceDays)
+	}
+	return i.CheckLoanLength(start, end)
+}
+
+// CheckLoanLength validates only the loan length against the item's duration.
+func (i *Item) CheckLoanLength(start, end time.Time) error {
+	if days := LoanDays(start, end); i.Duration > 0 && days > i.Duration {
+		return fmt.Errorf("%w: requested %d day(s), maximum is %d", ErrLoanTooLong, days, i.Duration)
+	}
+	return nil
+}
+
+// CheckCancellation reports whether an approved loan starting at start may
+// still be cancelled at now.
+func (i *Item) CheckCancellation(start, now time.Time) error {
+	deadline := start.Add(-time.Duration(i.CancellationWindowHours) * time.Hour)
+	if !now.Before(deadline) {
+		if i.CancellationWindowHours > 0 {
+			return fmt.Errorf("%w: approved loans must be cancelled at least %d hour(s) before they start", ErrCancellationClosed, i.CancellationWindowHours)
+		}
+		return fmt.Errorf("%w: the loan has already started", ErrCancellationClosed)
+	}
+	return nil
+}
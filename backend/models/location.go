@@ -0,0 +1,106 @@
+package models
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"resource-sharing/geo"
+)
+
+// itemDistance is the haversine distance in km from the point given as the
+// arguments latitude, latitude, longitude to an item's approximate position.
+const itemDistance = `2 * ? * ASIN(LEAST(1, SQRT(
+	POWER(SIN(RADIANS(items.approx_latitude - ?) / 2), 2) +
+	COS(RADIANS(?)) * COS(RADIANS(items.approx_latitude)) *
+	POWER(SIN(RADIANS(items.approx_longitude - ?) / 2), 2))))`
+
+func itemDistanceArgs(center geo.Point) []interface{} {
+	return []interface{}{geo.EarthRadiusKm, center.Lat, center.Lat, center.Lng}
+}
+
+// SetPosition sets the item's exact and approximate position, or clears
+// both when p is nil.
+func (item *Item) SetPosition(p *geo.Point) {
+	if p == nil {
+		item.Latitude, item.Longitude = nil, nil
+		item.ApproxLatitude, item.ApproxLongitude = nil, nil
+		return
+	}
+	coarse := p.Coarse()
+	item.Latitude, item.Longitude = &p.Lat, &p.Lng
+	item.ApproxLatitude, item.ApproxLongitude = &coarse.Lat, &coarse.Lng
+}
+
+// approxPosition returns the item's approximate position, if it has one.
+func (item *Item) approxPosition() (geo.Point, bool) {
+	if item.ApproxLatitude == nil || item.ApproxLongitude == nil {
+		return geo.Point{}, false
+	}
+	return geo.Point{Lat: *item.ApproxLatitude, Lng: *item.ApproxLongitude}, true
+}
+
+// usesMathFunctions reports whether the database has the trigonometric
+// functions needed to measure distances in SQL.
+func usesMathFunctions(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
+
+// ItemsNear restricts an item query to items whose approximate position is
+// within radiusKm of center. Where the database cannot measure distances
+// only the bounding box of the circle is checked; NearestItems trims the
+// results to the circle.
+func ItemsNear(query *gorm.DB, center geo.Point, radiusKm float64) *gorm.DB {
+	box := geo.BoundingBox(center, radiusKm)
+	query = query.Where("items.approx_latitude BETWEEN ? AND ? AND items.approx_longitude BETWEEN ? AND ?",
+		box.MinLat, box.MaxLat, box.MinLng, box.MaxLng)
+	if usesMathFunctions(query) {
+		query = query.Where(itemDistance+" <= ?", append(itemDistanceArgs(center), radiusKm)...)
+	}
+	return query
+}
+
+// NearestItems returns up to limit items of a query filtered by ItemsNear,
+// closest first, after skipping offset of them. Distance is set on each.
+func NearestItems(query *gorm.DB, center geo.Point, radiusKm float64, offset, limit int) ([]Item, error) {
+	var items []Item
+	if usesMathFunctions(query) {
+		err := query.
+			Clauses(clause.OrderBy{Expression: clause.Expr{SQL: itemDistance + ", items.id", Vars: itemDistanceArgs(center), WithoutParentheses: true}}).
+			Offset(offset).Limit(limit).
+			Find(&items).Error
+		SetDistances(items, center)
+		return items, err
+	}
+
+	// Without them every item in the box has to be measured to sort them
+	if err := query.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	SetDistances(items, center)
+	inside := items[:0]
+	for _, item := range items {
+		if item.Distance <= radiusKm {
+			inside = append(inside, item)
+		}
+	}
+	sort.SliceStable(inside, func(a, b int) bool { return inside[a].Distance < inside[b].Distance })
+	if offset > len(inside) {
+		offset = len(inside)
+	}
+	if offset+limit < len(inside) {
+		return inside[offset : offset+limit], nil
+	}
+	return inside[offset:], nil
+}
+
+// SetDistances sets Distance on items to the distance from center to their
+// approximate position.
+func SetDistances(items []Item, center geo.Point) {
+	for i := range items {
+		if p, ok := items[i].approxPosition(); ok {
+			items[i].Distance = geo.Distance(center, p)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// AutoMigrate creates or updates the tables of every model.
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(&User{}, &Item{}, &BorrowRequest{}, &LoanExtension{}, &WaitlistEntry{},
+		&ConditionReport{}, &ConditionPhoto{},
+		&Dispute{}, &DisputeStatement{}, &DisputeEvidence{},
+		&LedgerEntry{}, &Review{}, &AutoApprovalRule{}, &AuditEntry{},
+		&BlockedBuyer{}, &BorrowGroup{}, &ItemUnit{}, &Category{},
+		&CategoryAttribute{}, &ItemAttribute{}, &Tag{})
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences caps how many loans a single recurring request may expand
+// into.
+const MaxOccurrences = 52
+
+// maxRecurrenceYears bounds how far ahead a recurrence is expanded.
+const maxRecurrenceYears = 2
+
+var ErrTooManyOccurrences = fmt.Errorf("recurrence expands to more than %d occurrences", MaxOccurrences)
+
+// Frequency is the FREQ part of a recurrence rule.
+type Frequency string
+
+const (
+	FrequencyDaily  Frequency = "DAILY"
+	FrequencyWeekly Frequency = "WEEKLY"
+)
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Recurrence is the subset of an iCalendar RRULE that borrow requests
+// support: FREQ (DAILY or WEEKLY), INTERVAL, BYDAY, and one of COUNT or
+// UNTIL. For example "FREQ=WEEKLY;BYDAY=TU;COUNT=6" repeats every Tuesday
+// six times.
+type Recurrence struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    *time.Time
+}
+
+// ParseRecurrence parses an RRULE string such as
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;UNTIL=20261231". An optional "RRULE:"
+// prefix is accepted.
+func ParseRecurrence(s string) (Recurrence, error) {
+	rec := Recurrence{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return rec, errors.New("recurrence rule is empty")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return rec, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rec.Freq = Frequency(strings.ToUpper(value))
+			if rec.Freq != FrequencyDaily && rec.Freq != FrequencyWeekly {
+				return rec, fmt.Errorf("unsupported recurrence frequency %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return rec, fmt.Errorf("invalid recurrence interval %q", value)
+			}
+			rec.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return rec, fmt.Errorf("invalid recurrence count %q", value)
+			}
+			rec.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return rec, err
+			}
+			rec.Until = &until
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := weekdayCodes[strings.ToUpper(code)]
+				if !ok {
+					return rec, fmt.Errorf("invalid recurrence weekday %q", code)
+				}
+				rec.ByDay = append(rec.ByDay, day)
+			}
+		default:
+			return rec, fmt.Errorf("unsupported recurrence rule part %q", key)
+		}
+	}
+
+	if rec.Freq == "" {
+		return rec, errors.New("recurrence rule needs a FREQ")
+	}
+	if (rec.Count == 0) == (rec.Until == nil) {
+		return rec, errors.New("recurrence rule needs exactly one of COUNT or UNTIL")
+	}
+	if rec.Count > MaxOccurrences {
+		return rec, ErrTooManyOccurrences
+	}
+
+	// Weeks run Monday to Sunday, as with the RRULE default WKST=MO
+	sort.Slice(rec.ByDay, func(i, j int) bool { return weekdayIndex(rec.ByDay[i]) < weekdayIndex(rec.ByDay[j]) })
+	return rec, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A bare date includes the whole day
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid recurrence end %q", value)
+}
+
+// weekdayIndex numbers the days of the week from Monday = 0.
+func weekdayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+// Occurrences returns the start times of the recurrence beginning at start.
+// Occurrences keep the time of day of start. Dates before start, or that are
+// not one of ByDay, are skipped, so start itself is only included if it
+// matches the rule.
+func (rec Recurrence) Occurrences(start time.Time) ([]time.Time, error) {
+	var out []time.Time
+	// A rule whose BYDAY never lines up with its interval would otherwise
+	// never finish
+	horizon := start.AddDate(maxRecurrenceYears, 0, 0)
+	// add appends t and reports whether expansion should continue
+	add := func(t time.Time) (bool, error) {
+		if rec.Until != nil && t.After(*rec.Until) || t.After(horizon) {
+			return false, nil
+		}
+		if len(out) == MaxOccurrences {
+			return false, ErrTooManyOccurrences
+		}
+		out = append(out, t)
+		return rec.Count == 0 || len(out) < rec.Count, nil
+	}
+
+	switch rec.Freq {
+	case FrequencyWeekly:
+		days := rec.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		weekStart := start.AddDate(0, 0, -weekdayIndex(start.Weekday()))
+		for week := 0; ; week += rec.Interval {
+			for _, day := range days {
+				t := weekStart.AddDate(0, 0, 7*week+weekdayIndex(day))
+				if t.Before(start) {
+					continue
+				}
+				more, err := add(t)
+				if err != nil || !more {
+					return out, err
+				}
+			}
+		}
+	default:
+		for n := 0; ; n += rec.Interval {
+			t := start.AddDate(0, 0, n)
+			if t.After(horizon) {
+				return out, nil
+			}
+			if len(rec.ByDay) > 0 && !containsWeekday(rec.ByDay, t.Weekday()) {
+				continue
+			}
+			more, err := add(t)
+			if err != nil || !more {
+				return out, err
+			}
+		}
+	}
+}
+
+func containsWeekday(days []time.Weekday, d time.Weekday) bool {
+	for _, day := range days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
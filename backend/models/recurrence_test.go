@@ -0,0 +1,161 @@
+package models_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"resource-sharing/models"
+)
+
+// TestParseRecurrence checks the parsed fields of a full rule and the rules
+// that are refused.
+func TestParseRecurrence(t *testing.T) {
+	rec, err := models.ParseRecurrence("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TH,MO;UNTIL=20261231T120000Z")
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	until := time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC)
+	want := models.Recurrence{
+		Freq:     models.FrequencyWeekly,
+		Interval: 2,
+		ByDay:    []time.Weekday{time.Monday, time.Thursday},
+		Until:    &until,
+	}
+	if !reflect.DeepEqual(rec, want) {
+		t.Errorf("got %+v, want %+v", rec, want)
+	}
+
+	// A bare UNTIL date includes the whole day
+	rec, err = models.ParseRecurrence("FREQ=DAILY;UNTIL=20261231")
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	if want := time.Date(2026, 12, 31, 23, 59, 59, 999999999, time.UTC); !rec.Until.Equal(want) {
+		t.Errorf("until = %s, want %s", rec.Until, want)
+	}
+
+	invalid := []string{
+		"",
+		"COUNT=3",
+		"FREQ=MONTHLY;COUNT=3",
+		"FREQ=DAILY",
+		"FREQ=DAILY;COUNT=3;UNTIL=20261231",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;INTERVAL=0;COUNT=3",
+		"FREQ=WEEKLY;BYDAY=XX;COUNT=3",
+		"FREQ=DAILY;UNTIL=2026-12-31",
+		"FREQ=DAILY;COUNT",
+		"FREQ=DAILY;WKST=MO;COUNT=3",
+	}
+	for _, s := range invalid {
+		if _, err := models.ParseRecurrence(s); err == nil {
+			t.Errorf("%q: parsed without error", s)
+		}
+	}
+
+	if _, err := models.ParseRecurrence("FREQ=DAILY;COUNT=53"); !errors.Is(err, models.ErrTooManyOccurrences) {
+		t.Errorf("COUNT=53: got %v, want ErrTooManyOccurrences", err)
+	}
+}
+
+// TestOccurrences expands rules from a Monday at 10:00.
+func TestOccurrences(t *testing.T) {
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	// at returns 10:00 on the given day of 2026
+	at := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 10, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []time.Time
+	}{
+		{
+			"count", "FREQ=WEEKLY;BYDAY=TU;COUNT=3", start,
+			[]time.Time{at(1, 6), at(1, 13), at(1, 20)},
+		},
+		{
+			"until a bare date includes that day", "FREQ=WEEKLY;BYDAY=TU;UNTIL=20260120", start,
+			[]time.Time{at(1, 6), at(1, 13), at(1, 20)},
+		},
+		{
+			"until a time excludes later occurrences", "FREQ=WEEKLY;BYDAY=TU;UNTIL=20260120T000000Z", start,
+			[]time.Time{at(1, 6), at(1, 13)},
+		},
+		{
+			"weekly interval with several days", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TH,MO;COUNT=5", at(1, 7),
+			[]time.Time{at(1, 8), at(1, 19), at(1, 22), at(2, 2), at(2, 5)},
+		},
+		{
+			"weekly without days repeats the start day", "FREQ=WEEKLY;COUNT=2", start,
+			[]time.Time{at(1, 5), at(1, 12)},
+		},
+		{
+			"daily interval", "FREQ=DAILY;INTERVAL=3;COUNT=3", start,
+			[]time.Time{at(1, 5), at(1, 8), at(1, 11)},
+		},
+		{
+			"daily on weekends", "FREQ=DAILY;BYDAY=SA,SU;COUNT=4", start,
+			[]time.Time{at(1, 10), at(1, 11), at(1, 17), at(1, 18)},
+		},
+		{
+			"stops at the horizon", "FREQ=WEEKLY;INTERVAL=60;UNTIL=20991231", start,
+			[]time.Time{at(1, 5), start.AddDate(0, 0, 7*60)},
+		},
+		{
+			"never matches within the horizon", "FREQ=DAILY;INTERVAL=7;BYDAY=TU;UNTIL=20991231", start,
+			nil,
+		},
+		{
+			"never matches before the count is reached", "FREQ=DAILY;INTERVAL=14;BYDAY=WE;COUNT=3", start,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		rec, err := models.ParseRecurrence(tt.rule)
+		if err != nil {
+			t.Fatalf("%s: parsing %q: %v", tt.name, tt.rule, err)
+		}
+		got, err := rec.Occurrences(tt.start)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestOccurrencesCap checks that a rule may expand to exactly
+// MaxOccurrences loans but no more.
+func TestOccurrencesCap(t *testing.T) {
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+
+	rec, err := models.ParseRecurrence("FREQ=WEEKLY;COUNT=52")
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	got, err := rec.Occurrences(start)
+	if err != nil {
+		t.Fatalf("expanding: %v", err)
+	}
+	if len(got) != models.MaxOccurrences {
+		t.Fatalf("got %d occurrences, want %d", len(got), models.MaxOccurrences)
+	}
+	if last := start.AddDate(0, 0, 7*51); !got[len(got)-1].Equal(last) {
+		t.Errorf("last occurrence = %s, want %s", got[len(got)-1], last)
+	}
+
+	rec, err = models.ParseRecurrence("FREQ=DAILY;UNTIL=20261231")
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	if _, err := rec.Occurrences(start); !errors.Is(err, models.ErrTooManyOccurrences) {
+		t.Errorf("daily for a year: got %v, want ErrTooManyOccurrences", err)
+	}
+}
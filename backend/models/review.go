@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReviewDirection says who reviewed whom.
+type ReviewDirection string
+
+const (
+	// ReviewOfSeller is written by the buyer and rates both the item and
+	// its seller.
+	ReviewOfSeller ReviewDirection = "buyer_to_seller"
+	// ReviewOfBuyer is written by the seller about the buyer.
+	ReviewOfBuyer ReviewDirection = "seller_to_buyer"
+)
+
+// Review is one party's rating of a returned loan. Reviews stay hidden until
+// both parties have submitted or the review window closes, so neither side
+// can retaliate.
+type Review struct {
+	ID              uint            `json:"id" gorm:"primaryKey"`
+	BorrowRequestID uint            `json:"borrowRequestId" gorm:"not null;uniqueIndex:idx_reviews_request_reviewer"`
+	ReviewerID      uint            `json:"reviewerId" gorm:"not null;uniqueIndex:idx_reviews_request_reviewer"`
+	Reviewer        User            `json:"reviewer" gorm:"foreignKey:ReviewerID"`
+	RevieweeID      uint            `json:"revieweeId" gorm:"not null;index"`
+	ItemID          *uint           `json:"itemId" gorm:"index"`
+	Direction       ReviewDirection `json:"direction" gorm:"not null"`
+	Score           int             `json:"score" gorm:"not null"`
+	Text            string          `json:"text"`
+	PublishedAt     *time.Time      `json:"publishedAt"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+}
+
+// PublishReviews makes every hidden review of a loan visible and refreshes the
+// affected rating aggregates.
+func PublishReviews(db *gorm.DB, borrowRequestID uint, now time.Time) error {
+	var reviews []Review
+	if err := db.Where("borrow_request_id = ? AND published_at IS NULL", borrowRequestID).Find(&reviews).Error; err != nil {
+		return err
+	}
+
+	for _, review := range reviews {
+		if err := db.Model(&Review{}).Where("id = ?", review.ID).Update("published_at", now).Error; err != nil {
+			return err
+		}
+		if err := refreshUserRating(db, review.RevieweeID); err != nil {
+			return err
+		}
+		if review.ItemID != nil {
+			if err := refreshItemRating(db, *review.ItemID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type ratingAggregate struct {
+	Average float64
+	Count   int
+}
+
+func refreshUserRating(db *gorm.DB, userID uint) error {
+	var agg ratingAggregate
+	if err := db.Model(&Review{}).
+		Select("COALESCE(AVG(score), 0) AS average, COUNT(*) AS count").
+		Where("reviewee_id = ? AND published_at IS NOT NULL", userID).
+		Scan(&agg).Error; err != nil {
+		return err
+	}
+	return db.Model(&User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"rating_average": agg.Average, "rating_count": agg.Count}).Error
+}
+
+func refreshItemRating(db *gorm.DB, itemID uint) error {
+	var agg ratingAggregate
+	if err := db.Model(&Review{}).
+		Select("COALESCE(AVG(score), 0) AS average, COUNT(*) AS count").
+		Where("item_id = ? AND published_at IS NOT NULL", itemID).
+		Scan(&agg).Error; err != nil {
+		return err
+	}
+	return db.Model(&Item{}).Where("id = ?", itemID).
+		Updates(map[string]interface{}{"rating_average": agg.Average, "rating_count": agg.Count}).Error
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// snippetRadius is how many characters of context the fallback search keeps
+// on each side of the first match in a snippet.
+const snippetRadius = 60
+
+// itemDocument is the weighted Postgres text search document of an item.
+// Title matches rank above category matches, which rank above description
+// matches.
+const itemDocument = `setweight(to_tsvector('english', coalesce(items.title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(items.category, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(items.description, '')), 'C')`
+
+// usesFullTextSearch reports whether the database supports Postgres text
+// search. Other databases, such as SQLite in tests, fall back to LIKE.
+func usesFullTextSearch(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
+
+// EnsureSearchIndex creates the index backing item search on Postgres.
+func EnsureSearchIndex(db *gorm.DB) error {
+	if !usesFullTextSearch(db) {
+		return nil
+	}
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_items_search ON items USING GIN ((" + itemDocument + "))").Error
+}
+
+// escapedDescription is an item's description HTML-escaped the way
+// html.EscapeString does it, so search snippets can safely add marks to it.
+const escapedDescription = `replace(replace(replace(replace(replace(coalesce(items.description, ''),
+	'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// itemTSQuery parses the search text given as the named argument @q.
+const itemTSQuery = "websearch_to_tsquery('english', @q)"
+
+// SearchItems restricts an item query to items matching the search text q.
+func SearchItems(query *gorm.DB, q string) *gorm.DB {
+	if usesFullTextSearch(query) {
+		return query.Where("("+itemDocument+") @@ "+itemTSQuery, map[string]interface{}{"q": q})
+	}
+
+	for _, term := range searchTerms(q) {
+		like := "%" + term + "%"
+		query = query.Where("LOWER(items.title) LIKE ? OR LOWER(items.description) LIKE ? OR LOWER(items.category) LIKE ?", like, like, like)
+	}
+	return query
+}
+
+// WithSearchRank makes an item query return each item's SearchRank and a
+// SearchSnippet of its HTML-escaped description with matches wrapped in
+// <mark> tags. It only works on Postgres; elsewhere call ScoreSearchResults on the results.
+func WithSearchRank(query *gorm.DB, q string) *gorm.DB {
+	if !usesFullTextSearch(query) {
+		return query
+	}
+	return query.Select("items.*, ts_rank("+itemDocument+", "+itemTSQuery+") AS search_rank, "+
+		"ts_headline('english', "+escapedDescription+", "+itemTSQuery+
+		", 'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10') AS search_snippet",
+		map[string]interface{}{"q": q})
+}
+
+// RankedSearch returns up to limit items of a query filtered by SearchItems,
+// best matches first, after skipping offset of them.
+func RankedSearch(query *gorm.DB, q string, offset, limit int) ([]Item, error) {
+	var items []Item
+	if usesFullTextSearch(query) {
+		err := WithSearchRank(query, q).
+			Order("search_rank DESC, items.id").
+			Offset(offset).Limit(limit).
+			Find(&items).Error
+		return items, err
+	}
+
+	// Without full-text search every match has to be scored to sort them
+	if err := query.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	ScoreSearchResults(query, items, q)
+	sort.SliceStable(items, func(a, b int) bool { return items[a].SearchRank > items[b].SearchRank })
+	if offset > len(items) {
+		offset = len(items)
+	}
+	if offset+limit < len(items) {
+		return items[offset : offset+limit], nil
+	}
+	return items[offset:], nil
+}
+
+// ScoreSearchResults sets SearchRank and SearchSnippet on items found by
+// SearchItems when the database has no full-text search, using the same
+// title, category and description weighting. It does nothing on Postgres.
+func ScoreSearchResults(db *gorm.DB, items []Item, q string) {
+	if usesFullTextSearch(db) {
+		return
+	}
+	terms := searchTerms(q)
+	for i := range items {
+		title := strings.ToLower(items[i].Title)
+		category := strings.ToLower(items[i].Category)
+		description := strings.ToLower(items[i].Description)
+		var rank float64
+		for _, term := range terms {
+			rank += 1.0*float64(strings.Count(title, term)) +
+				0.4*float64(strings.Count(category, term)) +
+				0.2*float64(strings.Count(description, term))
+		}
+		items[i].SearchRank = rank
+		items[i].SearchSnippet = snippet(items[i].Description, terms)
+	}
+}
+
+func searchTerms(q string) []string {
+	return strings.Fields(strings.ToLower(q))
+}
+
+// snippet cuts text around the first search term it contains and marks every
+// term in the cut. The text is HTML-escaped so the marks are its only markup.
+// Terms are matched rune by rune, folding case, since lowercasing can change
+// how many bytes a character takes.
+func snippet(text string, terms []string) string {
+	runes := []rune(text)
+	folded := make([][]rune, len(terms))
+	for i, term := range terms {
+		folded[i] = []rune(term)
+	}
+
+	first := -1
+	for i := range runes {
+		if matchAt(runes, i, folded) > 0 {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		if len(runes) > 2*snippetRadius {
+			runes = runes[:2*snippetRadius]
+		}
+		return html.EscapeString(string(runes))
+	}
+
+	start, end := first-snippetRadius, first+snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	cut := runes[start:end]
+	plain := 0
+	for i := 0; i < len(cut); {
+		n := matchAt(cut, i, folded)
+		if n == 0 {
+			i++
+			continue
+		}
+		b.WriteString(html.EscapeString(string(cut[plain:i])))
+		b.WriteString("<mark>" + html.EscapeString(string(cut[i:i+n])) + "</mark>")
+		i += n
+		plain = i
+	}
+	b.WriteString(html.EscapeString(string(cut[plain:])))
+	return b.String()
+}
+
+// matchAt returns the length of the longest term starting at runes[i], or 0
+// if none does.
+func matchAt(runes []rune, i int, terms [][]rune) int {
+	longest := 0
+	for _, term := range terms {
+		if len(term) > longest && hasFoldPrefix(runes[i:], term) {
+			longest = len(term)
+		}
+	}
+	return longest
+}
+
+func hasFoldPrefix(s, prefix []rune) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i, r := range prefix {
+		if !equalFoldRune(s[i], r) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFoldRune reports whether a and b are the same letter under simple
+// Unicode case folding.
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
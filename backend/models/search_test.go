@@ -0,0 +1,51 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"resource-sharing/models"
+	"resource-sharing/testdb"
+)
+
+// TestRankedSearchFallback covers the LIKE search used when the database
+// has no Postgres text search.
+func TestRankedSearchFallback(t *testing.T) {
+	db := testdb.Open(t)
+	seller := models.User{Name: "Seller", Email: "seller@example.com", Password: "x", Role: models.RoleSeller}
+	testdb.Create(t, db, &seller)
+
+	items := []models.Item{
+		{Title: "Cordless Drill", Category: "Tools", Description: "<b>Drill</b> & bits"},
+		{Title: "Hammer", Category: "Tools", Description: strings.Repeat("Ⱥ", 100) + " drill"},
+		{Title: "Ladder", Category: "Tools", Description: strings.Repeat("no match ", 20)},
+	}
+	for i := range items {
+		items[i].Status = models.StatusAvailable
+		items[i].Duration = 7
+		items[i].Quantity = 1
+		items[i].SellerID = seller.ID
+		testdb.Create(t, db, &items[i])
+	}
+
+	query := models.SearchItems(db.Model(&models.Item{}), "DRILL")
+	found, err := models.RankedSearch(query, "DRILL", 0, 10)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found %d items, want 2", len(found))
+	}
+	// The title match outranks the description-only match
+	if found[0].Title != "Cordless Drill" || found[1].Title != "Hammer" {
+		t.Errorf("ranked %q before %q", found[0].Title, found[1].Title)
+	}
+
+	if got, want := found[0].SearchSnippet, "&lt;b&gt;<mark>Drill</mark>&lt;/b&gt; &amp; bits"; got != want {
+		t.Errorf("snippet = %q, want %q", got, want)
+	}
+	// Characters whose lowercase form is longer in bytes must not shift the cut
+	if got, want := found[1].SearchSnippet, strings.Repeat("Ⱥ", 59)+" <mark>drill</mark>"; got != want {
+		t.Errorf("snippet = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// MaxItemTags caps how many tags a single item may carry.
+const MaxItemTags = 20
+
+var ErrTooManyTags = fmt.Errorf("an item can have at most %d tags", MaxItemTags)
+
+// Tag is a free-form label sellers put on items, such as "cordless". Names
+// are stored in slug form so "Cordless" and "cordless" are the same tag.
+type Tag struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"uniqueIndex;not null"`
+}
+
+// NormalizeTags slugifies tag names and drops empty and repeated ones.
+func NormalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, name := range names {
+		tag := Slugify(name)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > MaxItemTags {
+		return nil, ErrTooManyTags
+	}
+	return tags, nil
+}
+
+// SetItemTags replaces the item's tags with the normalized names, creating
+// tags that don't exist yet.
+func SetItemTags(tx *gorm.DB, item *Item, names []string) error {
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tag := Tag{Name: name}
+		if err := tx.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+	}
+	if err := tx.Model(item).Association("Tags").Replace(tags); err != nil {
+		return err
+	}
+	item.Tags = tags
+	return nil
+}
+
+// TaggedWith restricts an item query to items carrying the tag.
+func TaggedWith(query *gorm.DB, tag string) *gorm.DB {
+	return query.Where("EXISTS (SELECT 1 FROM item_tags JOIN tags ON tags.id = item_tags.tag_id "+
+		"WHERE item_tags.item_id = items.id AND tags.name = ?)", Slugify(tag))
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Actor identifies who triggers a borrow request status change.
+type Actor string
+
+const (
+	ActorBuyer  Actor = "buyer"
+	ActorSeller Actor = "seller"
+	ActorSystem Actor = "system"
+)
+
+// ErrInvalidTransition is wrapped by every TransitionError.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// borrowRequestTransitions lists, for each status, the statuses a borrow
+// request may move to and the actors allowed to make that move.
+var borrowRequestTransitions = map[Status]map[Status][]Actor{
+	StatusPending: {
+		StatusApproved:  {ActorSeller, ActorSystem},
+		StatusDenied:    {ActorSeller, ActorSystem},
+		StatusCancelled: {ActorBuyer},
+		StatusExpired:   {ActorSystem},
+	},
+	StatusApproved: {
+		StatusActive:    {ActorSeller},
+		StatusCancelled: {ActorBuyer},
+		StatusExpired:   {ActorSystem},
+	},
+	StatusActive: {
+		StatusReturned: {ActorSeller},
+		StatusOverdue:  {ActorSystem},
+	},
+	StatusOverdue: {
+		StatusActive:   {ActorSeller},
+		StatusReturned: {ActorSeller},
+	},
+}
+
+// TransitionError describes a status change that the state machine rejects.
+type TransitionError struct {
+	From  Status
+	To    Status
+	Actor Actor
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("a %s borrow request cannot be moved to %s by the %s", e.From, e.To, e.Actor)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// CanTransition reports whether actor may move a borrow request from one
+// status to another.
+func CanTransition(from, to Status, actor Actor) error {
+	for _, allowed := range borrowRequestTransitions[from][to] {
+		if allowed == actor {
+			return nil
+		}
+	}
+	return &TransitionError{From: from, To: to, Actor: actor}
+}
+
+// LockTransition locks the row of borrow request id until the transaction
+// ends and checks that its stored status still lets actor move it to status
+// to. Handlers that loaded the request before their transaction call it, so
+// that two concurrent changes of the same request cannot both pass. It must
+// run inside a transaction.
+func LockTransition(tx *gorm.DB, id uint, to Status, actor Actor) error {
+	var current BorrowRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&current, id).Error; err != nil {
+		return err
+	}
+	return CanTransition(current.Status, to, actor)
+}
+
+// TransitionTo validates and applies a status change. The caller is
+// responsible for saving the request.
+func (b *BorrowRequest) TransitionTo(to Status, actor Actor) error {
+	if err := CanTransition(b.Status, to, actor); err != nil {
+		return err
+	}
+	b.Status = to
+	return nil
+}
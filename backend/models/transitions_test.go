@@ -0,0 +1,78 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"resource-sharing/models"
+)
+
+// TestCanTransition checks every (from, to, actor) triple over the borrow
+// request statuses against the moves the state machine allows.
+func TestCanTransition(t *testing.T) {
+	type move struct {
+		from, to models.Status
+		actor    models.Actor
+	}
+	allowed := map[move]bool{
+		{models.StatusPending, models.StatusApproved, models.ActorSeller}:  true,
+		{models.StatusPending, models.StatusApproved, models.ActorSystem}:  true,
+		{models.StatusPending, models.StatusDenied, models.ActorSeller}:    true,
+		{models.StatusPending, models.StatusDenied, models.ActorSystem}:    true,
+		{models.StatusPending, models.StatusCancelled, models.ActorBuyer}:  true,
+		{models.StatusPending, models.StatusExpired, models.ActorSystem}:   true,
+		{models.StatusApproved, models.StatusActive, models.ActorSeller}:   true,
+		{models.StatusApproved, models.StatusCancelled, models.ActorBuyer}: true,
+		{models.StatusApproved, models.StatusExpired, models.ActorSystem}:  true,
+		{models.StatusActive, models.StatusReturned, models.ActorSeller}:   true,
+		{models.StatusActive, models.StatusOverdue, models.ActorSystem}:    true,
+		{models.StatusOverdue, models.StatusActive, models.ActorSeller}:    true,
+		{models.StatusOverdue, models.StatusReturned, models.ActorSeller}:  true,
+	}
+
+	statuses := []models.Status{
+		models.StatusPending, models.StatusApproved, models.StatusDenied,
+		models.StatusCancelled, models.StatusExpired, models.StatusActive,
+		models.StatusOverdue, models.StatusReturned,
+	}
+	actors := []models.Actor{models.ActorBuyer, models.ActorSeller, models.ActorSystem}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			for _, actor := range actors {
+				err := models.CanTransition(from, to, actor)
+				if allowed[move{from, to, actor}] {
+					if err != nil {
+						t.Errorf("%s -> %s by %s: unexpected error %v", from, to, actor, err)
+					}
+					continue
+				}
+				if !errors.Is(err, models.ErrInvalidTransition) {
+					t.Errorf("%s -> %s by %s: got %v, want ErrInvalidTransition", from, to, actor, err)
+					continue
+				}
+				var te *models.TransitionError
+				if !errors.As(err, &te) || te.From != from || te.To != to || te.Actor != actor {
+					t.Errorf("%s -> %s by %s: got %#v", from, to, actor, err)
+				}
+			}
+		}
+	}
+}
+
+// TestTransitionTo checks that a rejected move leaves the status alone.
+func TestTransitionTo(t *testing.T) {
+	br := models.BorrowRequest{Status: models.StatusPending}
+	if err := br.TransitionTo(models.StatusActive, models.ActorSeller); err == nil {
+		t.Fatal("pending request was picked up")
+	}
+	if br.Status != models.StatusPending {
+		t.Errorf("rejected transition changed status to %s", br.Status)
+	}
+	if err := br.TransitionTo(models.StatusApproved, models.ActorSeller); err != nil {
+		t.Fatalf("approving: %v", err)
+	}
+	if br.Status != models.StatusApproved {
+		t.Errorf("status = %s, want approved", br.Status)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
-// Status represents the status of an item or borrow request
+// Status represents the status of an item, borrow request, loan extension,
+// waitlist entry or dispute
 type Status string
 
 const (
@@ -8,8 +9,21 @@ const (
 	StatusApproved  Status = "approved"
 	StatusDenied    Status = "denied"
 	StatusReturned  Status = "returned"
+	StatusCancelled Status = "cancelled"
+	StatusExpired   Status = "expired"
+	StatusActive    Status = "active"
+	StatusOverdue   Status = "overdue"
+	StatusWaiting   Status = "waiting"
+	StatusOffered   Status = "offered"
+	StatusClaimed   Status = "claimed"
 	StatusAvailable Status = "available"
 	StatusBorrowed  Status = "borrowed"
+	StatusFrozen    Status = "frozen"
+	StatusOpen      Status = "open"
+	StatusResolved  Status = "resolved"
+
+	// StatusMaintenance takes an item unit out of service.
+	StatusMaintenance Status = "maintenance"
 )
 
 // Role represents the role of a user
@@ -18,4 +32,7 @@ type Role string
 const (
 	RoleBuyer  Role = "buyer"
 	RoleSeller Role = "seller"
+	// RoleAdmin users resolve disputes. They cannot self-register and are
+	// created directly in the database.
+	RoleAdmin Role = "admin"
 )
\ No newline at end of file
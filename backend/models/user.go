@@ -5,11 +5,18 @@ import (
 )
 
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name" gorm:"not null"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"` // Don't include password in JSON
-	Role      Role      `json:"role" gorm:"not null"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Name     string `json:"name" gorm:"not null"`
+	Email    string `json:"email" gorm:"unique;not null"`
+	Password string `json:"-" gorm:"not null"` // Don't include password in JSON
+	Role     Role   `json:"role" gorm:"not null"`
+	// RatingAverage and RatingCount summarise the published reviews about
+	// this user.
+	RatingAverage float64 `json:"ratingAverage"`
+	RatingCount   int     `json:"ratingCount"`
+	// MaxLoansPerBuyer caps how many units a single buyer may hold on this
+	// seller's items at once. Zero means no limit.
+	MaxLoansPerBuyer int       `json:"maxLoansPerBuyer"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
 }
\ No newline at end of file
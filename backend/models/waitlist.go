@@ -0,0 +1,97 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WaitlistEntry queues a buyer for an item that is currently borrowed. When
+// the item becomes available the oldest waiting entry is offered the item and
+// holds it until OfferExpiresAt. A request made during the offer is recorded
+// in ClaimedRequestID, and the offer is only claimed once that request is
+// approved; until then it can still lapse and pass to the next buyer.
+type WaitlistEntry struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	ItemID           uint       `json:"itemId" gorm:"not null;index"`
+	Item             Item       `json:"item" gorm:"foreignKey:ItemID"`
+	BuyerID          uint       `json:"buyerId" gorm:"not null;index"`
+	Buyer            User       `json:"buyer" gorm:"foreignKey:BuyerID"`
+	Status           Status     `json:"status" gorm:"not null"`
+	OfferedAt        *time.Time `json:"offeredAt"`
+	OfferExpiresAt   *time.Time `json:"offerExpiresAt"`
+	ClaimedRequestID *uint      `json:"claimedRequestId"`
+	// Position is the 1-based place in the queue of a waiting entry. It is
+	// computed on read and not stored.
+	Position  int       `json:"position,omitempty" gorm:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// FindActiveWaitlistOffer returns the unexpired offer on an item, or nil if
+// the item is not being held for anyone.
+func FindActiveWaitlistOffer(db *gorm.DB, itemID uint, now time.Time) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	err := db.Where("item_id = ? AND status = ? AND offer_expires_at > ?", itemID, StatusOffered, now).
+		First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// BlocksBooking reports whether the offer keeps buyerID from booking the item
+// from start to end. The hold only matters for loans that start before it
+// expires, and never for the buyer it was offered to.
+func (e *WaitlistEntry) BlocksBooking(buyerID uint, start, end, now time.Time) bool {
+	return e.BuyerID != buyerID && Overlaps(start, end, now, *e.OfferExpiresAt)
+}
+
+// ClaimWaitlistOffer marks the offer a request was made under as claimed,
+// once the request is approved.
+func ClaimWaitlistOffer(db *gorm.DB, br *BorrowRequest) error {
+	return db.Model(&WaitlistEntry{}).
+		Where("claimed_request_id = ? AND status = ?", br.ID, StatusOffered).
+		Update("status", StatusClaimed).Error
+}
+
+// OfferNextWaitlistEntry offers the item to the longest-waiting buyer, holding
+// it for window. It does nothing and returns nil if an offer is already
+// outstanding or nobody is waiting.
+func OfferNextWaitlistEntry(db *gorm.DB, itemID uint, now time.Time, window time.Duration) (*WaitlistEntry, error) {
+	active, err := FindActiveWaitlistOffer(db, itemID, now)
+	if err != nil || active != nil {
+		return nil, err
+	}
+
+	var next WaitlistEntry
+	err = db.Where("item_id = ? AND status = ?", itemID, StatusWaiting).Order("id").First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(window)
+	next.Status = StatusOffered
+	next.OfferedAt = &now
+	next.OfferExpiresAt = &expires
+	if err := db.Save(&next).Error; err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// WaitlistPosition returns the 1-based queue position of a waiting entry.
+func WaitlistPosition(db *gorm.DB, entry *WaitlistEntry) (int, error) {
+	var ahead int64
+	err := db.Model(&WaitlistEntry{}).
+		Where("item_id = ? AND status = ? AND id < ?", entry.ItemID, StatusWaiting, entry.ID).
+		Count(&ahead).Error
+	return int(ahead) + 1, err
+}
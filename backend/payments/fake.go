@@ -0,0 +1,76 @@
+package payments
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Operation is a call recorded by FakeProcessor.
+type Operation struct {
+	Key    string
+	Method string
+	Ref    string
+	UserID uint
+	Amount int64
+}
+
+// FakeProcessor is an in-memory Processor for tests and local development.
+// It records every call and never moves real money. Calls repeating an
+// idempotency key are answered from the first call and not recorded again.
+// Setting Err makes every subsequent call fail with it.
+type FakeProcessor struct {
+	mu         sync.Mutex
+	next       int
+	operations []Operation
+	refs       map[string]string
+	Err        error
+}
+
+func NewFakeProcessor() *FakeProcessor {
+	return &FakeProcessor{refs: make(map[string]string)}
+}
+
+func (p *FakeProcessor) Hold(key string, buyerID uint, amount int64, description string) (string, error) {
+	return p.record(key, "hold", "", buyerID, amount)
+}
+
+func (p *FakeProcessor) Capture(key string, holdRef string, amount int64) error {
+	_, err := p.record(key, "capture", holdRef, 0, amount)
+	return err
+}
+
+func (p *FakeProcessor) Release(key string, holdRef string, amount int64) error {
+	_, err := p.record(key, "release", holdRef, 0, amount)
+	return err
+}
+
+func (p *FakeProcessor) Charge(key string, buyerID uint, amount int64, description string) (string, error) {
+	return p.record(key, "charge", "", buyerID, amount)
+}
+
+// Operations returns a copy of the calls recorded so far.
+func (p *FakeProcessor) Operations() []Operation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ops := make([]Operation, len(p.operations))
+	copy(ops, p.operations)
+	return ops
+}
+
+func (p *FakeProcessor) record(key, method, ref string, userID uint, amount int64) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return "", p.Err
+	}
+	if seen, ok := p.refs[key]; ok {
+		return seen, nil
+	}
+	if ref == "" {
+		p.next++
+		ref = fmt.Sprintf("fake_%s_%d", method, p.next)
+	}
+	p.refs[key] = ref
+	p.operations = append(p.operations, Operation{Key: key, Method: method, Ref: ref, UserID: userID, Amount: amount})
+	return ref, nil
+}
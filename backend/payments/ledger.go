@@ -0,0 +1,231 @@
+package payments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+)
+
+// post writes a balanced pair of pending ledger entries moving amount from
+// one account to another. The processor is only called for them by Flush,
+// after the transaction that wrote them has committed.
+func post(tx *gorm.DB, borrowRequestID uint, kind models.LedgerEntryKind, from, to models.LedgerAccount, amount int64) error {
+	txnID, err := newTransactionID()
+	if err != nil {
+		return err
+	}
+	entries := []models.LedgerEntry{
+		{BorrowRequestID: borrowRequestID, TransactionID: txnID, Kind: kind, Account: from, AmountCents: -amount, Status: models.EntryPending},
+		{BorrowRequestID: borrowRequestID, TransactionID: txnID, Kind: kind, Account: to, AmountCents: amount, Status: models.EntryPending},
+	}
+	return tx.Create(&entries).Error
+}
+
+func newTransactionID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CollectAtPickup records the item's deposit hold and the loan fee for each
+// unit when a loan starts. Items without a deposit or fee are skipped.
+func CollectAtPickup(tx *gorm.DB, br *models.BorrowRequest) error {
+	units := int64(br.Quantity)
+	if deposit := br.Item.DepositCents * units; deposit > 0 {
+		if err := post(tx, br.ID, models.EntryDepositHeld, models.AccountBuyer, models.AccountEscrow, deposit); err != nil {
+			return err
+		}
+	}
+
+	if fee := br.Item.DailyFeeCents * int64(models.LoanDays(br.StartDate, br.EndDate)) * units; fee > 0 {
+		if err := post(tx, br.ID, models.EntryFeeCharged, models.AccountBuyer, models.AccountSeller, fee); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChargeExtension records the loan fee for the days an extension adds to a
+// loan that was already picked up. The fee for the original dates was taken
+// at pickup, so only days past previousEnd are charged.
+func ChargeExtension(tx *gorm.DB, br *models.BorrowRequest, previousEnd time.Time) error {
+	added := models.LoanDays(br.StartDate, br.EndDate) - models.LoanDays(br.StartDate, previousEnd)
+	if fee := br.Item.DailyFeeCents * int64(added) * int64(br.Quantity); fee > 0 {
+		return post(tx, br.ID, models.EntryExtensionFee, models.AccountBuyer, models.AccountSeller, fee)
+	}
+	return nil
+}
+
+// SettleDeposit records how the deposit held for a loan is closed out. damage
+// is paid to the seller out of the deposit, with any shortfall charged to the
+// buyer, and the remainder of the deposit is refunded.
+func SettleDeposit(tx *gorm.DB, br *models.BorrowRequest, damage int64) error {
+	held, err := models.LedgerBalance(tx, br.ID, models.AccountEscrow)
+	if err != nil {
+		return err
+	}
+
+	fromDeposit := damage
+	if fromDeposit > held {
+		fromDeposit = held
+	}
+
+	if fromDeposit > 0 {
+		if err := post(tx, br.ID, models.EntryDamageDeducted, models.AccountEscrow, models.AccountSeller, fromDeposit); err != nil {
+			return err
+		}
+	}
+
+	if shortfall := damage - fromDeposit; shortfall > 0 {
+		if err := post(tx, br.ID, models.EntryDamageDeducted, models.AccountBuyer, models.AccountSeller, shortfall); err != nil {
+			return err
+		}
+	}
+
+	if refund := held - fromDeposit; refund > 0 {
+		if err := post(tx, br.ID, models.EntryDepositRefunded, models.AccountEscrow, models.AccountBuyer, refund); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chargeDescriptions labels the charges a buyer sees for each kind of
+// transaction taken straight from their payment method.
+var chargeDescriptions = map[models.LedgerEntryKind]string{
+	models.EntryFeeCharged:     "Fee",
+	models.EntryExtensionFee:   "Extension fee",
+	models.EntryDamageDeducted: "Damage",
+}
+
+// pendingTransaction is one ledger transaction waiting on the processor.
+type pendingTransaction struct {
+	id       string
+	kind     models.LedgerEntryKind
+	from, to models.LedgerAccount
+	amount   int64
+}
+
+// Flush calls the processor for the pending ledger transactions of a loan,
+// oldest first, and marks each one posted with the processor's reference.
+// The transaction ID is the idempotency key, so a Flush retried after a crash
+// or a failed call never moves money twice. It stops at the first failure,
+// leaving that transaction and the ones after it pending.
+func Flush(db *gorm.DB, p Processor, borrowRequestID uint) error {
+	var entries []models.LedgerEntry
+	if err := db.Where("borrow_request_id = ? AND status = ?", borrowRequestID, models.EntryPending).
+		Order("id").Find(&entries).Error; err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var pending []*pendingTransaction
+	byID := make(map[string]*pendingTransaction)
+	for _, e := range entries {
+		txn, ok := byID[e.TransactionID]
+		if !ok {
+			txn = &pendingTransaction{id: e.TransactionID, kind: e.Kind}
+			byID[e.TransactionID] = txn
+			pending = append(pending, txn)
+		}
+		if e.AmountCents < 0 {
+			txn.from = e.Account
+		} else {
+			txn.to = e.Account
+			txn.amount = e.AmountCents
+		}
+	}
+
+	var br models.BorrowRequest
+	if err := db.First(&br, borrowRequestID).Error; err != nil {
+		return err
+	}
+
+	for _, txn := range pending {
+		ref, err := execute(db, p, &br, txn)
+		if err != nil {
+			return fmt.Errorf("ledger transaction %s: %w", txn.id, err)
+		}
+		if err := db.Model(&models.LedgerEntry{}).
+			Where("transaction_id = ?", txn.id).
+			Updates(map[string]interface{}{"status": models.EntryPosted, "processor_ref": ref}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute makes the processor call that moves the money of one ledger
+// transaction and returns its reference.
+func execute(db *gorm.DB, p Processor, br *models.BorrowRequest, txn *pendingTransaction) (string, error) {
+	if txn.kind == models.EntryDepositHeld {
+		ref, err := p.Hold(txn.id, br.BuyerID, txn.amount, fmt.Sprintf("Deposit for borrow request %d", br.ID))
+		if err != nil {
+			return "", fmt.Errorf("holding deposit: %w", err)
+		}
+		return ref, nil
+	}
+
+	if txn.from == models.AccountEscrow {
+		// Money leaving escrow comes out of the deposit hold, which Flush
+		// always posts before anything settling it
+		var hold models.LedgerEntry
+		if err := db.Where("borrow_request_id = ? AND kind = ? AND account = ? AND status = ?",
+			br.ID, models.EntryDepositHeld, models.AccountEscrow, models.EntryPosted).
+			Order("id DESC").First(&hold).Error; err != nil {
+			return "", fmt.Errorf("finding deposit hold: %w", err)
+		}
+		switch txn.to {
+		case models.AccountSeller:
+			if err := p.Capture(txn.id, hold.ProcessorRef, txn.amount); err != nil {
+				return "", fmt.Errorf("capturing deposit: %w", err)
+			}
+		case models.AccountBuyer:
+			if err := p.Release(txn.id, hold.ProcessorRef, txn.amount); err != nil {
+				return "", fmt.Errorf("refunding deposit: %w", err)
+			}
+		default:
+			return "", fmt.Errorf("cannot move deposit to %s", txn.to)
+		}
+		return hold.ProcessorRef, nil
+	}
+
+	description, ok := chargeDescriptions[txn.kind]
+	if !ok || txn.from != models.AccountBuyer {
+		return "", errors.New("no processor call for " + string(txn.kind))
+	}
+	ref, err := p.Charge(txn.id, br.BuyerID, txn.amount, fmt.Sprintf("%s for borrow request %d", description, br.ID))
+	if err != nil {
+		return "", fmt.Errorf("charging %s: %w", txn.kind, err)
+	}
+	return ref, nil
+}
+
+// FlushAll flushes every loan that still has pending ledger transactions. A
+// loan whose processor call fails does not hold up the others.
+func FlushAll(db *gorm.DB, p Processor) error {
+	var ids []uint
+	if err := db.Model(&models.LedgerEntry{}).
+		Where("status = ?", models.EntryPending).
+		Distinct().Pluck("borrow_request_id", &ids).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range ids {
+		if err := Flush(db, p, id); err != nil {
+			errs = append(errs, fmt.Errorf("borrow request %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
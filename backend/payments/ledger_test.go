@@ -0,0 +1,223 @@
+package payments
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"resource-sharing/models"
+	"resource-sharing/testdb"
+)
+
+// seedLoan creates an active two-unit, three-day loan of an item with a
+// 5000 cent deposit and a 300 cent daily fee per unit.
+func seedLoan(t *testing.T, db *gorm.DB) *models.BorrowRequest {
+	t.Helper()
+	seller := models.User{Name: "Seller", Email: "seller@example.com", Password: "x", Role: models.RoleSeller}
+	buyer := models.User{Name: "Buyer", Email: "buyer@example.com", Password: "x", Role: models.RoleBuyer}
+	testdb.Create(t, db, &seller, &buyer)
+	item := models.Item{Title: "Drill", Category: "Tools", Status: models.StatusBorrowed, Duration: 7, Quantity: 2,
+		SellerID: seller.ID, DepositCents: 5000, DailyFeeCents: 300}
+	testdb.Create(t, db, &item)
+	start := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	br := models.BorrowRequest{ItemID: item.ID, BuyerID: buyer.ID, Status: models.StatusActive,
+		StartDate: start, EndDate: start.Add(3 * 24 * time.Hour), Quantity: 2}
+	testdb.Create(t, db, &br)
+	br.Item = item
+	return &br
+}
+
+// commit runs fn in a transaction and then flushes the loan's payments, the
+// way handlers do.
+func commit(t *testing.T, db *gorm.DB, p Processor, br *models.BorrowRequest, fn func(tx *gorm.DB) error) {
+	t.Helper()
+	if err := db.Transaction(fn); err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if err := Flush(db, p, br.ID); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+}
+
+// call is a recorded operation reduced to its method and amount.
+type call struct {
+	Method string
+	Amount int64
+}
+
+func calls(p *FakeProcessor) []call {
+	var got []call
+	for _, op := range p.Operations() {
+		got = append(got, call{op.Method, op.Amount})
+	}
+	return got
+}
+
+func balance(t *testing.T, db *gorm.DB, br *models.BorrowRequest, account models.LedgerAccount) int64 {
+	t.Helper()
+	b, err := models.LedgerBalance(db, br.ID, account)
+	if err != nil {
+		t.Fatalf("reading %s balance: %v", account, err)
+	}
+	return b
+}
+
+func TestCollectAtPickup(t *testing.T) {
+	db := testdb.Open(t)
+	p := NewFakeProcessor()
+	br := seedLoan(t, db)
+
+	commit(t, db, p, br, func(tx *gorm.DB) error { return CollectAtPickup(tx, br) })
+
+	want := []call{{"hold", 10000}, {"charge", 1800}}
+	if got := calls(p); !reflect.DeepEqual(got, want) {
+		t.Fatalf("processor calls = %v, want %v", got, want)
+	}
+	if got := balance(t, db, br, models.AccountEscrow); got != 10000 {
+		t.Errorf("escrow = %d, want 10000", got)
+	}
+	if got := balance(t, db, br, models.AccountSeller); got != 1800 {
+		t.Errorf("seller = %d, want 1800", got)
+	}
+
+	var pending int64
+	db.Model(&models.LedgerEntry{}).Where("status = ?", models.EntryPending).Count(&pending)
+	if pending != 0 {
+		t.Errorf("%d entries still pending after flush", pending)
+	}
+}
+
+func TestSettleDeposit(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage int64
+		want   []call
+		escrow int64
+		seller int64
+		buyer  int64
+	}{
+		{
+			name:   "no damage",
+			damage: 0,
+			want:   []call{{"release", 10000}},
+			seller: 1800,
+			buyer:  -1800,
+		},
+		{
+			name:   "damage within deposit",
+			damage: 2500,
+			want:   []call{{"capture", 2500}, {"release", 7500}},
+			seller: 4300,
+			buyer:  -4300,
+		},
+		{
+			name:   "damage beyond deposit",
+			damage: 12000,
+			want:   []call{{"capture", 10000}, {"charge", 2000}},
+			seller: 13800,
+			buyer:  -13800,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testdb.Open(t)
+			p := NewFakeProcessor()
+			br := seedLoan(t, db)
+			commit(t, db, p, br, func(tx *gorm.DB) error { return CollectAtPickup(tx, br) })
+			pickup := len(p.Operations())
+
+			commit(t, db, p, br, func(tx *gorm.DB) error { return SettleDeposit(tx, br, tt.damage) })
+
+			if got := calls(p)[pickup:]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("processor calls = %v, want %v", got, tt.want)
+			}
+			holdRef := p.Operations()[0].Ref
+			for _, op := range p.Operations()[pickup:] {
+				if op.Method != "charge" && op.Ref != holdRef {
+					t.Errorf("%s used ref %q, want the deposit hold %q", op.Method, op.Ref, holdRef)
+				}
+			}
+			for account, want := range map[models.LedgerAccount]int64{
+				models.AccountEscrow: tt.escrow,
+				models.AccountSeller: tt.seller,
+				models.AccountBuyer:  tt.buyer,
+			} {
+				if got := balance(t, db, br, account); got != want {
+					t.Errorf("%s = %d, want %d", account, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChargeExtension(t *testing.T) {
+	db := testdb.Open(t)
+	p := NewFakeProcessor()
+	br := seedLoan(t, db)
+	commit(t, db, p, br, func(tx *gorm.DB) error { return CollectAtPickup(tx, br) })
+
+	// Two more days on two units at 300 cents a day
+	previousEnd := br.EndDate
+	br.EndDate = previousEnd.Add(2 * 24 * time.Hour)
+	commit(t, db, p, br, func(tx *gorm.DB) error { return ChargeExtension(tx, br, previousEnd) })
+
+	want := []call{{"hold", 10000}, {"charge", 1800}, {"charge", 1200}}
+	if got := calls(p); !reflect.DeepEqual(got, want) {
+		t.Fatalf("processor calls = %v, want %v", got, want)
+	}
+	if got := balance(t, db, br, models.AccountSeller); got != 3000 {
+		t.Errorf("seller = %d, want 3000", got)
+	}
+}
+
+func TestFlushRetriesFailedCallsOnce(t *testing.T) {
+	db := testdb.Open(t)
+	p := NewFakeProcessor()
+	br := seedLoan(t, db)
+
+	// The loan change commits even though the processor is down
+	p.Err = errors.New("processor unavailable")
+	if err := db.Transaction(func(tx *gorm.DB) error { return CollectAtPickup(tx, br) }); err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if err := Flush(db, p, br.ID); err == nil {
+		t.Fatal("flush succeeded with the processor down")
+	}
+	var pending int64
+	db.Model(&models.LedgerEntry{}).Where("status = ?", models.EntryPending).Count(&pending)
+	if pending != 4 {
+		t.Fatalf("%d entries pending, want all 4", pending)
+	}
+
+	// Retrying flushes everything, and flushing again calls nothing
+	p.Err = nil
+	if err := FlushAll(db, p); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if err := FlushAll(db, p); err != nil {
+		t.Fatalf("second retry failed: %v", err)
+	}
+	want := []call{{"hold", 10000}, {"charge", 1800}}
+	if got := calls(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("processor calls = %v, want %v", got, want)
+	}
+}
+
+func TestFakeProcessorIdempotencyKeys(t *testing.T) {
+	p := NewFakeProcessor()
+	first, err := p.Charge("key", 1, 500, "Fee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := p.Charge("key", 1, 500, "Fee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first || len(p.Operations()) != 1 {
+		t.Errorf("repeated key charged again: refs %q and %q, %d operations", first, again, len(p.Operations()))
+	}
+}
@@ -0,0 +1,18 @@
+// Package payments moves deposit and fee money through a pluggable payment
+// processor and records every movement in the loan ledger.
+package payments
+
+// Processor is implemented by payment providers. Amounts are in cents. Every
+// call takes an idempotency key: repeating a call with a key the processor
+// has already seen returns the original result without moving money again.
+type Processor interface {
+	// Hold authorises amount on the buyer's payment method without taking
+	// it and returns a reference for later Capture or Release calls.
+	Hold(key string, buyerID uint, amount int64, description string) (string, error)
+	// Capture takes amount out of a hold.
+	Capture(key string, holdRef string, amount int64) error
+	// Release returns amount of a hold to the buyer.
+	Release(key string, holdRef string, amount int64) error
+	// Charge takes amount from the buyer immediately.
+	Charge(key string, buyerID uint, amount int64, description string) (string, error)
+}
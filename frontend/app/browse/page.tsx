@@ -7,17 +7,35 @@ import { Button } from "@/components/ui/button"
 import { Card, CardContent, CardFooter, CardHeader, CardTitle } from "@/components/ui/card"
 import { Badge } from "@/components/ui/badge"
 import { toast } from "@/components/ui/use-toast"
-import { api } from "@/lib/api"
+import { fetchPage } from "@/lib/api"
 import type { Item } from "@/lib/types"
 import { SearchFilters } from "@/components/search-filters"
 import { BorrowDialog } from "@/components/borrow-dialog"
 
+// Transform an item from the API to ensure it has the correct structure
+function toItem(item: any): Item {
+  return {
+    id: item.id || item.ID, // Try both formats
+    title: item.title || "",
+    description: item.description || "",
+    category: item.category || "",
+    imageUrl: item.imageUrl || item.ImageURL || "",
+    status: item.status || "available",
+    location: item.location || "",
+    duration: item.duration || 7,
+    sellerId: item.sellerId || item.SellerID || 0,
+    seller: item.seller || { name: "Unknown" }
+  }
+}
+
 export default function BrowsePage() {
   const { user } = useAuth()
   const searchParams = useSearchParams()
 
   const [items, setItems] = useState<Item[]>([])
   const [isLoading, setIsLoading] = useState(true)
+  const [nextCursor, setNextCursor] = useState<string | undefined>()
+  const [isLoadingMore, setIsLoadingMore] = useState(false)
   const [selectedItem, setSelectedItem] = useState<Item | null>(null)
   const [dialogOpen, setDialogOpen] = useState(false)
 
@@ -25,46 +43,37 @@ export default function BrowsePage() {
   const location = searchParams.get("location")
   const status = searchParams.get("status") || "available"
 
+  let url = "/api/items?status=available"
+
+  if (category) {
+    url += `&category=${category}`
+  }
+
+  if (location) {
+    url += `&location=${location}`
+  }
+
   useEffect(() => {
     const fetchItems = async () => {
       setIsLoading(true)
       try {
-        let url = "/api/items?status=available"
-
-        if (category) {
-          url += `&category=${category}`
-        }
-
-        if (location) {
-          url += `&location=${location}`
-        }
-
-        const response = await api.get(url)
-        console.log("Fetched items response:", response)
+        const page = await fetchPage<any>(url)
+        const data = page.items
+        console.log("Fetched items:", data)
         
         // Check if the response data is an array and has items
-        if (Array.isArray(response.data) && response.data.length > 0) {
-          console.log("First item from API:", response.data[0])
+        if (Array.isArray(data) && data.length > 0) {
+          console.log("First item from API:", data[0])
           
-          // Transform the items to ensure they have the correct structure
-          const transformedItems = response.data.map((item: any) => ({
-            id: item.id || item.ID, // Try both formats
-            title: item.title || "",
-            description: item.description || "",
-            category: item.category || "",
-            imageUrl: item.imageUrl || item.ImageURL || "",
-            status: item.status || "available",
-            location: item.location || "",
-            duration: item.duration || 7,
-            sellerId: item.sellerId || item.SellerID || 0,
-            seller: item.seller || { name: "Unknown" }
-          }))
+          const transformedItems = data.map(toItem)
           
           console.log("Transformed items:", transformedItems[0])
           setItems(transformedItems)
+          setNextCursor(page.nextCursor)
         } else {
-          console.warn("No items returned from API or invalid format:", response.data)
+          console.warn("No items returned from API or invalid format:", data)
           setItems([])
+          setNextCursor(undefined)
         }
       } catch (error) {
         console.error("Error fetching items:", error)
@@ -74,6 +83,7 @@ export default function BrowsePage() {
           variant: "destructive",
         })
         setItems([])
+        setNextCursor(undefined)
       } finally {
         setIsLoading(false)
       }
@@ -82,6 +92,26 @@ export default function BrowsePage() {
     fetchItems()
   }, [category, location, status])
 
+  const handleLoadMore = async () => {
+    if (!nextCursor) return
+
+    setIsLoadingMore(true)
+    try {
+      const page = await fetchPage<any>(url, nextCursor)
+      setItems((current) => [...current, ...page.items.map(toItem)])
+      setNextCursor(page.nextCursor)
+    } catch (error) {
+      console.error("Error fetching more items:", error)
+      toast({
+        title: "Error",
+        description: "Failed to fetch more items",
+        variant: "destructive",
+      })
+    } finally {
+      setIsLoadingMore(false)
+    }
+  }
+
   const handleBorrowClick = (item: Item) => {
     console.log("Selected item for borrowing:", item)
     
@@ -184,6 +214,14 @@ export default function BrowsePage() {
             ))}
           </div>
         )}
+
+        {nextCursor && (
+          <div className="flex justify-center">
+            <Button variant="outline" onClick={handleLoadMore} disabled={isLoadingMore}>
+              {isLoadingMore ? "Loading..." : "Load more"}
+            </Button>
+          </div>
+        )}
       </div>
 
       {selectedItem && (
@@ -7,7 +7,7 @@ import { Button } from "@/components/ui/button"
 import { Card, CardContent, CardFooter, CardHeader, CardTitle } from "@/components/ui/card"
 import { Badge } from "@/components/ui/badge"
 import { toast } from "@/components/ui/use-toast"
-import { api } from "@/lib/api"
+import { api, fetchPage } from "@/lib/api"
 import type { Item } from "@/lib/types"
 
 export default function ItemsPage() {
@@ -15,15 +15,18 @@ export default function ItemsPage() {
   const [items, setItems] = useState<Item[]>([])
   const [allItems, setAllItems] = useState<Item[]>([]) // Store all items for debugging
   const [isLoading, setIsLoading] = useState(true)
+  const [nextCursor, setNextCursor] = useState<string | undefined>()
+  const [isLoadingMore, setIsLoadingMore] = useState(false)
   const [error, setError] = useState<string | null>(null)
 
   useEffect(() => {
     const fetchItems = async () => {
       try {
         console.log("Fetching items for seller ID:", user?.id)
-        const response = await api.get("/api/my-items") // Use the new endpoint
-        console.log("My items received:", response.data)
-        setItems(response.data)
+        const page = await fetchPage<Item>("/api/my-items") // Use the new endpoint
+        console.log("My items received:", page.items)
+        setItems(page.items)
+        setNextCursor(page.nextCursor)
       } catch (error: any) {
         console.error("Error fetching items:", error)
         setError(error.response?.data || error.message || "Failed to fetch items")
@@ -44,6 +47,26 @@ export default function ItemsPage() {
     }
   }, [user])
 
+  const handleLoadMore = async () => {
+    if (!nextCursor) return
+
+    setIsLoadingMore(true)
+    try {
+      const page = await fetchPage<Item>("/api/my-items", nextCursor)
+      setItems((current) => [...current, ...page.items])
+      setNextCursor(page.nextCursor)
+    } catch (error) {
+      console.error("Error fetching more items:", error)
+      toast({
+        title: "Error",
+        description: "Failed to fetch more items",
+        variant: "destructive",
+      })
+    } finally {
+      setIsLoadingMore(false)
+    }
+  }
+
   const handleDeleteItem = async (id: number) => {
     if (window.confirm("Are you sure you want to delete this item?")) {
       try {
@@ -146,6 +169,14 @@ export default function ItemsPage() {
           ))}
         </div>
       )}
+
+      {nextCursor && (
+        <div className="flex justify-center">
+          <Button variant="outline" onClick={handleLoadMore} disabled={isLoadingMore}>
+            {isLoadingMore ? "Loading..." : "Load more"}
+          </Button>
+        </div>
+      )}
     </div>
   )
   
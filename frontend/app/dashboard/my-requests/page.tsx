@@ -2,10 +2,11 @@
 
 import { useEffect, useState } from "react"
 import { useAuth } from "@/lib/auth-context"
+import { Button } from "@/components/ui/button"
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card"
 import { Badge } from "@/components/ui/badge"
 import { toast } from "@/components/ui/use-toast"
-import { api } from "@/lib/api"
+import { fetchPage } from "@/lib/api"
 import type { BorrowRequest } from "@/lib/types"
 import { format } from "date-fns"
 
@@ -13,12 +14,15 @@ export default function MyRequestsPage() {
   const { user } = useAuth()
   const [requests, setRequests] = useState<BorrowRequest[]>([])
   const [isLoading, setIsLoading] = useState(true)
+  const [nextCursor, setNextCursor] = useState<string | undefined>()
+  const [isLoadingMore, setIsLoadingMore] = useState(false)
 
   useEffect(() => {
     const fetchRequests = async () => {
       try {
-        const response = await api.get("/api/my-requests")
-        setRequests(response.data)
+        const page = await fetchPage<BorrowRequest>("/api/my-requests")
+        setRequests(page.items)
+        setNextCursor(page.nextCursor)
       } catch (error) {
         toast({
           title: "Error",
@@ -35,6 +39,26 @@ export default function MyRequestsPage() {
     }
   }, [user])
 
+  const handleLoadMore = async () => {
+    if (!nextCursor) return
+
+    setIsLoadingMore(true)
+    try {
+      const page = await fetchPage<BorrowRequest>("/api/my-requests", nextCursor)
+      setRequests((current) => [...current, ...page.items])
+      setNextCursor(page.nextCursor)
+    } catch (error) {
+      console.error("Error fetching more borrow requests:", error)
+      toast({
+        title: "Error",
+        description: "Failed to fetch more of your borrow requests",
+        variant: "destructive",
+      })
+    } finally {
+      setIsLoadingMore(false)
+    }
+  }
+
   if (isLoading) {
     return (
       <div className="flex h-full items-center justify-center">
@@ -124,6 +148,13 @@ export default function MyRequestsPage() {
           ))}
         </div>
       )}
+      {nextCursor && (
+        <div className="flex justify-center">
+          <Button variant="outline" onClick={handleLoadMore} disabled={isLoadingMore}>
+            {isLoadingMore ? "Loading..." : "Load more"}
+          </Button>
+        </div>
+      )}
     </div>
   )
 }
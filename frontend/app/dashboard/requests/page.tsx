@@ -6,14 +6,43 @@ import { Button } from "@/components/ui/button"
 import { Card, CardContent, CardFooter, CardHeader, CardTitle } from "@/components/ui/card"
 import { Badge } from "@/components/ui/badge"
 import { toast } from "@/components/ui/use-toast"
-import { api } from "@/lib/api"
+import { api, fetchPage } from "@/lib/api"
 import type { BorrowRequest } from "@/lib/types"
 import { format } from "date-fns"
 
+// Map a borrow request from the API to ensure all required fields are present
+function toBorrowRequest(req: any): BorrowRequest {
+  // Log each request for debugging
+  console.log("Processing request:", req)
+  
+  // Check if ID exists and is a number
+  if (req.ID === undefined && req.id === undefined) {
+    console.error("Request is missing ID:", req)
+  }
+  
+  // Create a properly structured request object
+  return {
+    // Try both capitalized and lowercase field names
+    id: req.id || req.ID,
+    itemId: req.itemId || req.ItemID,
+    buyerId: req.buyerId || req.BuyerID,
+    status: req.status || req.Status,
+    startDate: req.startDate || req.StartDate,
+    endDate: req.endDate || req.EndDate,
+    message: req.message || req.Message,
+    item: req.item || req.Item,
+    buyer: req.buyer || req.Buyer,
+    createdAt: req.createdAt || req.CreatedAt,
+    updatedAt: req.updatedAt || req.UpdatedAt
+  }
+}
+
 export default function RequestsPage() {
   const { user } = useAuth()
   const [requests, setRequests] = useState<BorrowRequest[]>([])
   const [isLoading, setIsLoading] = useState(true)
+  const [nextCursor, setNextCursor] = useState<string | undefined>()
+  const [isLoadingMore, setIsLoadingMore] = useState(false)
   const [actionLoading, setActionLoading] = useState<number | null>(null)
   const [debugInfo, setDebugInfo] = useState<string>("")
 
@@ -21,49 +50,27 @@ export default function RequestsPage() {
     const fetchRequests = async () => {
       try {
         console.log("Fetching borrow requests for seller...")
-        const response = await api.get("/api/my-items/requests")
+        const page = await fetchPage<any>("/api/my-items/requests")
+        const data = page.items
         
         // Log the raw response data for debugging
-        console.log("Raw API response:", JSON.stringify(response.data, null, 2))
+        console.log("Raw API response:", JSON.stringify(data, null, 2))
         
         // Check if the response data is an array
-        if (!Array.isArray(response.data)) {
-          console.error("API response is not an array:", response.data)
-          setDebugInfo(`API response is not an array: ${JSON.stringify(response.data)}`)
+        if (!Array.isArray(data)) {
+          console.error("API response is not an array:", data)
+          setDebugInfo(`API response is not an array: ${JSON.stringify(data)}`)
           setRequests([])
           return
         }
         
         // Map the response data to ensure all required fields are present
-        const mappedRequests = response.data.map((req: any) => {
-          // Log each request for debugging
-          console.log("Processing request:", req)
-          
-          // Check if ID exists and is a number
-          if (req.ID === undefined && req.id === undefined) {
-            console.error("Request is missing ID:", req)
-          }
-          
-          // Create a properly structured request object
-          return {
-            // Try both capitalized and lowercase field names
-            id: req.id || req.ID,
-            itemId: req.itemId || req.ItemID,
-            buyerId: req.buyerId || req.BuyerID,
-            status: req.status || req.Status,
-            startDate: req.startDate || req.StartDate,
-            endDate: req.endDate || req.EndDate,
-            message: req.message || req.Message,
-            item: req.item || req.Item,
-            buyer: req.buyer || req.Buyer,
-            createdAt: req.createdAt || req.CreatedAt,
-            updatedAt: req.updatedAt || req.UpdatedAt
-          }
-        })
+        const mappedRequests = data.map(toBorrowRequest)
         
         console.log("Mapped requests:", mappedRequests)
         setDebugInfo(`Found ${mappedRequests.length} requests. First request: ${JSON.stringify(mappedRequests[0] || {})}`)
         setRequests(mappedRequests)
+        setNextCursor(page.nextCursor)
       } catch (error) {
         console.error("Error fetching borrow requests:", error)
         setDebugInfo(`Error fetching requests: ${error}`)
@@ -82,6 +89,26 @@ export default function RequestsPage() {
     }
   }, [user])
 
+  const handleLoadMore = async () => {
+    if (!nextCursor) return
+
+    setIsLoadingMore(true)
+    try {
+      const page = await fetchPage<any>("/api/my-items/requests", nextCursor)
+      setRequests((current) => [...current, ...page.items.map(toBorrowRequest)])
+      setNextCursor(page.nextCursor)
+    } catch (error) {
+      console.error("Error fetching more borrow requests:", error)
+      toast({
+        title: "Error",
+        description: "Failed to fetch more borrow requests",
+        variant: "destructive",
+      })
+    } finally {
+      setIsLoadingMore(false)
+    }
+  }
+
   const handleApproveRequest = async (requestId: number) => {
     console.log(`Attempting to approve request with ID: ${requestId}`)
     
@@ -316,6 +343,13 @@ export default function RequestsPage() {
           ))}
         </div>
       )}
+      {nextCursor && (
+        <div className="flex justify-center">
+          <Button variant="outline" onClick={handleLoadMore} disabled={isLoadingMore}>
+            {isLoadingMore ? "Loading..." : "Load more"}
+          </Button>
+        </div>
+      )}
     </div>
   )
 }
\ No newline at end of file
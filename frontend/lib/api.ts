@@ -1,4 +1,5 @@
 import axios from "axios"
+import type { Page } from "@/lib/types"
 
 // Create an axios instance with default config
 export const api = axios.create({
@@ -56,4 +57,12 @@ api.interceptors.response.use(
   },
 )
 
+// Fetch one page of a paginated list endpoint, starting after cursor if given
+export async function fetchPage<T>(url: string, cursor?: string): Promise<Page<T>> {
+  const separator = url.includes("?") ? "&" : "?"
+  const pageUrl = cursor ? `${url}${separator}cursor=${encodeURIComponent(cursor)}` : url
+  const response = await api.get<Page<T>>(pageUrl)
+  return response.data
+}
+
 export default api
\ No newline at end of file
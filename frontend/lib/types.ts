@@ -12,16 +12,30 @@ export interface Item {
   title: string;
   description: string;
   category: string;
+  categoryId?: number;
+  tags?: { id: number; name: string }[];
+  attributes?: { key: string; value: string }[];
   imageUrl: string;
   status: "available" | "borrowed";
   location: string;
   duration: number;
+  latitude?: number; // rounded to about a kilometre
+  longitude?: number;
+  distance?: number; // km, only on radius searches
   sellerId: number; 
   seller: User;
   createdAt?: string;
   updatedAt?: string;
 }
 
+export interface Category {
+  id: number;
+  name: string;
+  slug: string;
+  parentId?: number | null;
+  children?: Category[];
+}
+
 export interface BorrowRequest {
   id: number;
   itemId: number;
@@ -35,3 +49,9 @@ export interface BorrowRequest {
   createdAt?: string;
   updatedAt?: string;
 }
+
+export interface Page<T> {
+  items: T[]
+  nextCursor?: string
+  total?: number
+}